@@ -0,0 +1,140 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/jbrunsting/note-taker/api"
+)
+
+// Client talks to the api started by the api command
+type Client struct {
+	// Such as http://localhost:8081
+	BaseURL string
+	// http.DefaultClient is used if this is nil
+	HTTPClient *http.Client
+}
+
+// Error is a response from the api with an error status, a StatusCode of
+// http.StatusPreconditionFailed means the note changed since it was read
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// do sends body as JSON and decodes the JSON response into out, setting
+// If-Match when etag is not empty
+func (c *Client) do(method string, path string, query url.Values, etag string, body interface{}, out interface{}) error {
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&reqBody).Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, u, &reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var e api.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&e) != nil {
+			e.Error = resp.Status
+		}
+		return &Error{resp.StatusCode, e.Error}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func notePath(title string) string {
+	return "/notes/" + url.PathEscape(title)
+}
+
+// ListNotes returns up to limit of the notes matching any of the tag queries,
+// starting at offset, a limit of 0 uses the api default
+func (c *Client) ListNotes(tags []string, offset int, limit int) (api.NoteList, error) {
+	query := url.Values{"tags": tags}
+	query.Set("offset", strconv.Itoa(offset))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var list api.NoteList
+	err := c.do(http.MethodGet, "/notes", query, "", nil, &list)
+	return list, err
+}
+
+// GetNote returns the note with its content and ETag
+func (c *Client) GetNote(title string) (api.Note, error) {
+	var note api.Note
+	err := c.do(http.MethodGet, notePath(title), nil, "", nil, &note)
+	return note, err
+}
+
+// CreateNote creates a note with the next free id, the returned note has a
+// different title if the title was taken
+func (c *Client) CreateNote(n api.NewNote) (api.Note, error) {
+	var note api.Note
+	err := c.do(http.MethodPost, "/notes", nil, "", n, &note)
+	return note, err
+}
+
+// UpdateNote replaces the content of the note, failing if etag is set and the
+// note has changed since it was read
+func (c *Client) UpdateNote(title string, content string, etag string) (api.Note, error) {
+	var note api.Note
+	err := c.do(http.MethodPut, notePath(title), nil, etag, api.NoteUpdate{Content: content}, &note)
+	return note, err
+}
+
+// DeleteNote moves the note to the trash, failing if etag is set and the note
+// has changed since it was read
+func (c *Client) DeleteNote(title string, etag string) error {
+	return c.do(http.MethodDelete, notePath(title), nil, etag, nil, nil)
+}
+
+func (c *Client) Tags() ([]api.TagCount, error) {
+	tags := []api.TagCount{}
+	err := c.do(http.MethodGet, "/tags", nil, "", nil, &tags)
+	return tags, err
+}
+
+// Search runs a full text search over the notes matching any of the tag
+// queries
+func (c *Client) Search(q string, tags []string) ([]api.SearchResult, error) {
+	results := []api.SearchResult{}
+	err := c.do(http.MethodGet, "/search", url.Values{"q": {q}, "tags": tags}, "", nil, &results)
+	return results, err
+}
@@ -0,0 +1,247 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbrunsting/note-taker/api"
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+// newTestClient serves the api over an empty notes directory, returning the
+// directory and the number of times OnChange was called
+func newTestClient(t *testing.T) (*Client, string, *int) {
+	dir := t.TempDir()
+	changes := 0
+	s := &api.Server{
+		Manager:  &manager.Manager{Dir: dir},
+		OnChange: func() { changes += 1 },
+	}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return &Client{BaseURL: server.URL}, dir, &changes
+}
+
+func statusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+func TestCreateNote(t *testing.T) {
+	c, dir, changes := newTestClient(t)
+
+	note, err := c.CreateNote(api.NewNote{Title: "Plan", Tags: []string{"work"}, Content: "body\n"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	if note.Id != 1 || note.Title != "Plan" || note.ETag == "" {
+		t.Errorf("CreateNote returned %+v", note)
+	}
+	if note.Content != "[@1, #work]\nbody\n" {
+		t.Errorf("Content is %q", note.Content)
+	}
+	if *changes != 1 {
+		t.Errorf("OnChange was called %d times, want 1", *changes)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "Plan.md"))
+	if err != nil || string(content) != note.Content {
+		t.Errorf("Plan.md is %q, %v", content, err)
+	}
+
+	// A taken title gets a suffix
+	second, err := c.CreateNote(api.NewNote{Title: "Plan"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	if second.Id != 2 || second.Title != "Plan(2)" {
+		t.Errorf("Second note is %+v", second)
+	}
+}
+
+func TestCreateNoteRejectsInvalidNotes(t *testing.T) {
+	c, _, changes := newTestClient(t)
+
+	for _, n := range []api.NewNote{
+		{Title: ""},
+		{Title: "a/b"},
+		{Title: "Plan", Tags: []string{"two words"}},
+		{Title: "Plan", Template: "../../secret"},
+		{Title: "Plan", Template: "sub/template"},
+	} {
+		_, err := c.CreateNote(n)
+		if statusCode(err) != http.StatusBadRequest {
+			t.Errorf("CreateNote(%+v) returned %v, want a 400", n, err)
+		}
+	}
+	if *changes != 0 {
+		t.Errorf("OnChange was called %d times, want 0", *changes)
+	}
+}
+
+func TestGetNote(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	created, err := c.CreateNote(api.NewNote{Title: "Plan", Content: "body\n"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+
+	note, err := c.GetNote("Plan")
+	if err != nil {
+		t.Fatalf("GetNote: %v", err)
+	}
+	if note.ETag != created.ETag || note.Content != created.Content {
+		t.Errorf("GetNote returned %+v, want %+v", note, created)
+	}
+
+	_, err = c.GetNote("Missing")
+	if statusCode(err) != http.StatusNotFound {
+		t.Errorf("GetNote of a missing note returned %v, want a 404", err)
+	}
+}
+
+func TestUpdateNote(t *testing.T) {
+	c, dir, changes := newTestClient(t)
+	created, err := c.CreateNote(api.NewNote{Title: "Plan", Content: "first\n"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+
+	updated, err := c.UpdateNote("Plan", "[@1]\nsecond\n", created.ETag)
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	if updated.Content != "[@1]\nsecond\n" || updated.ETag == created.ETag {
+		t.Errorf("UpdateNote returned %+v", updated)
+	}
+	if *changes != 2 {
+		t.Errorf("OnChange was called %d times, want 2", *changes)
+	}
+
+	// The note changed since created.ETag was read
+	_, err = c.UpdateNote("Plan", "[@1]\nthird\n", created.ETag)
+	if statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("UpdateNote with a stale ETag returned %v, want a 412", err)
+	}
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "Plan.md"))
+	if string(content) != "[@1]\nsecond\n" {
+		t.Errorf("Plan.md is %q after a refused update", content)
+	}
+
+	// Without an ETag the update is unconditional
+	_, err = c.UpdateNote("Plan", "[@1]\nthird\n", "")
+	if err != nil {
+		t.Errorf("UpdateNote without an ETag: %v", err)
+	}
+
+	_, err = c.UpdateNote("Missing", "", "")
+	if statusCode(err) != http.StatusNotFound {
+		t.Errorf("UpdateNote of a missing note returned %v, want a 404", err)
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	c, dir, _ := newTestClient(t)
+	created, err := c.CreateNote(api.NewNote{Title: "Plan"})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	updated, err := c.UpdateNote("Plan", "[@1]\nchanged\n", created.ETag)
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+
+	err = c.DeleteNote("Plan", created.ETag)
+	if statusCode(err) != http.StatusPreconditionFailed {
+		t.Errorf("DeleteNote with a stale ETag returned %v, want a 412", err)
+	}
+	err = c.DeleteNote("Plan", updated.ETag)
+	if err != nil {
+		t.Fatalf("DeleteNote: %v", err)
+	}
+
+	_, err = c.GetNote("Plan")
+	if statusCode(err) != http.StatusNotFound {
+		t.Errorf("GetNote after deleting returned %v, want a 404", err)
+	}
+	// Deleted notes go to the trash
+	trashed, err := (&manager.Manager{Dir: dir}).ListTrash()
+	if err != nil || len(trashed) != 1 || trashed[0].Title != "Plan" {
+		t.Errorf("Trash holds %+v, %v", trashed, err)
+	}
+}
+
+func TestListNotesAndTags(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	for _, n := range []api.NewNote{
+		{Title: "A", Tags: []string{"work"}},
+		{Title: "B", Tags: []string{"work", "k8s"}},
+		{Title: "C", Tags: []string{"home"}},
+	} {
+		if _, err := c.CreateNote(n); err != nil {
+			t.Fatalf("CreateNote: %v", err)
+		}
+	}
+
+	list, err := c.ListNotes([]string{"work"}, 1, 1)
+	if err != nil {
+		t.Fatalf("ListNotes: %v", err)
+	}
+	// Notes are listed newest first
+	if list.Total != 2 || len(list.Notes) != 1 || list.Notes[0].Title != "A" {
+		t.Errorf("ListNotes returned %+v", list)
+	}
+
+	tags, err := c.Tags()
+	if err != nil {
+		t.Fatalf("Tags: %v", err)
+	}
+	got := []string{}
+	for _, tag := range tags {
+		got = append(got, fmt.Sprintf("%s:%d", tag.Tag, tag.Count))
+	}
+	if strings.Join(got, " ") != "work:2 home:1 k8s:1" {
+		t.Errorf("Tags returned %v", got)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	c, _, _ := newTestClient(t)
+	if _, err := c.CreateNote(api.NewNote{Title: "Plan"}); err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		allow  string
+	}{
+		{http.MethodPatch, "/notes", "GET, POST"},
+		{http.MethodPost, "/notes/Plan", "GET, PUT, DELETE"},
+		// The method is checked before looking for the note
+		{http.MethodPost, "/notes/Missing", "GET, PUT, DELETE"},
+		{http.MethodPost, "/tags", "GET"},
+	} {
+		req, err := http.NewRequest(test.method, c.BaseURL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != test.allow {
+			t.Errorf("%s %s returned %d with Allow %q, want 405 with Allow %q",
+				test.method, test.path, resp.StatusCode, resp.Header.Get("Allow"), test.allow)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+const (
+	notesPath    = "/notes"
+	tagsPath     = "/tags"
+	searchPath   = "/search"
+	defaultLimit = 50
+	maxLimit     = 1000
+)
+
+// Server serves a JSON api over the notes of a manager
+type Server struct {
+	Manager *manager.Manager
+	// Called after every change to the notes, such as to regenerate the html
+	OnChange func()
+
+	// The manager is not safe to use from several requests at once, and
+	// checking If-Match then writing must not be interleaved with other
+	// writes
+	mu sync.Mutex
+}
+
+// httpError is an error with the status code to respond with
+type httpError struct {
+	Status int
+	Msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.Msg
+}
+
+func errorf(status int, format string, a ...interface{}) error {
+	return &httpError{status, fmt.Sprintf(format, a...)}
+}
+
+// etag is the quoted sha1 of the content of a note, so it changes whenever
+// the content does
+func etag(content []byte) string {
+	return fmt.Sprintf("\"%x\"", sha1.Sum(content))
+}
+
+func toNote(note manager.Note) Note {
+	return Note{Id: note.Id, Title: note.Title, Notebook: note.Notebook, Tags: note.Tags, Modified: note.ModTime}
+}
+
+// Serve listens on addr until it fails
+func (s *Server) Serve(addr string) error {
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(notesPath, s.handle(s.handleNotes))
+	mux.HandleFunc(notesPath+"/", s.handle(s.handleNote))
+	mux.HandleFunc(tagsPath, s.handle(s.handleTags))
+	mux.HandleFunc(searchPath, s.handle(s.handleSearch))
+	return mux
+}
+
+// handle serializes requests and writes the result of h as JSON, or the
+// error it returns
+func (s *Server) handle(h func(w http.ResponseWriter, r *http.Request) (int, interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		status, body, err := h(w, r)
+		s.mu.Unlock()
+
+		if err != nil {
+			status = http.StatusInternalServerError
+			if he, ok := err.(*httpError); ok {
+				status = he.Status
+			}
+			body = ErrorResponse{err.Error()}
+		}
+		if body == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) error {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	return errorf(http.StatusMethodNotAllowed, "Method must be one of: %v", allowed)
+}
+
+func (s *Server) changed() {
+	if s.OnChange != nil {
+		s.OnChange()
+	}
+}
+
+func (s *Server) listNotes(r *http.Request) ([]manager.Note, error) {
+	query, err := manager.ParseTagQueries(r.URL.Query()["tags"])
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+	notes, err := s.Manager.ListNotes(query)
+	if err != nil {
+		return nil, err
+	}
+	manager.SortNotesById(notes)
+	return notes, nil
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, errorf(http.StatusBadRequest, "%s must be a non-negative integer", name)
+	}
+	return i, nil
+}
+
+// handleNotes lists the notes matching the tags parameters a page at a time,
+// or creates a note
+func (s *Server) handleNotes(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	if r.Method == http.MethodPost {
+		return s.createNote(w, r)
+	} else if r.Method != http.MethodGet {
+		return 0, nil, methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+
+	offset, err := intParam(r, "offset", 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	limit, err := intParam(r, "limit", defaultLimit)
+	if err != nil {
+		return 0, nil, err
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	notes, err := s.listNotes(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	list := NoteList{Notes: []Note{}, Total: len(notes), Offset: offset, Limit: limit}
+	for i := offset; i < len(notes) && i < offset+limit; i++ {
+		list.Notes = append(list.Notes, toNote(notes[i]))
+	}
+	return http.StatusOK, list, nil
+}
+
+func (s *Server) createNote(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	var n NewNote
+	err := json.NewDecoder(r.Body).Decode(&n)
+	if err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "Invalid note: %v", err)
+	}
+	if n.Title == "" || strings.ContainsAny(n.Title, "_/") {
+		return 0, nil, errorf(http.StatusBadRequest, "Title must be set and may not contain any underscores or slashes")
+	}
+	for _, tag := range n.Tags {
+		if err := manager.ValidateTag(tag); err != nil {
+			return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+		}
+	}
+	if err := manager.ValidateTemplate(n.Template); err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	title, err := s.Manager.Create(n.Title, func(id int) (string, error) {
+		content, err := s.Manager.NoteContent(n.Template, id, n.Title, n.Tags)
+		return content + n.Content, err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	s.changed()
+
+	note, content, err := s.readNote(title)
+	if err != nil {
+		return 0, nil, err
+	}
+	w.Header().Set("Location", notesPath+"/"+url.PathEscape(title))
+	w.Header().Set("ETag", note.ETag)
+	note.Content = content
+	return http.StatusCreated, note, nil
+}
+
+// readNote finds the note with the given name, its title prefixed by its
+// notebook, returning it with its ETag and its content
+func (s *Server) readNote(title string) (Note, string, error) {
+	notes, err := s.Manager.ListNotes(nil)
+	if err != nil {
+		return Note{}, "", err
+	}
+	for _, note := range notes {
+		if s.Manager.NoteName(note) != title {
+			continue
+		}
+		content, err := ioutil.ReadFile(note.Path)
+		if err != nil {
+			return Note{}, "", err
+		}
+		n := toNote(note)
+		n.ETag = etag(content)
+		return n, string(content), nil
+	}
+	return Note{}, "", errorf(http.StatusNotFound, "No note called '%s'", title)
+}
+
+// handleNote reads, replaces or deletes a single note. Changes are refused if
+// If-Match is set and does not match the current content of the note.
+func (s *Server) handleNote(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		return 0, nil, methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+
+	title := strings.TrimPrefix(r.URL.Path, notesPath+"/")
+	note, content, err := s.readNote(title)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("ETag", note.ETag)
+		if r.Header.Get("If-None-Match") == note.ETag {
+			return http.StatusNotModified, nil, nil
+		}
+		note.Content = content
+		return http.StatusOK, note, nil
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" && match != note.ETag {
+		return 0, nil, errorf(http.StatusPreconditionFailed, "'%s' has changed since it was read", title)
+	}
+
+	if r.Method == http.MethodDelete {
+		err = s.Manager.Delete(title)
+		if err != nil {
+			return 0, nil, err
+		}
+		s.changed()
+		return http.StatusNoContent, nil, nil
+	}
+
+	var update NoteUpdate
+	err = json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		return 0, nil, errorf(http.StatusBadRequest, "Invalid note: %v", err)
+	}
+	err = s.Manager.WriteNote(title, update.Content)
+	if os.IsNotExist(err) {
+		return 0, nil, errorf(http.StatusNotFound, "No note called '%s'", title)
+	} else if err != nil {
+		return 0, nil, err
+	}
+	s.changed()
+
+	note, content, err = s.readNote(title)
+	if err != nil {
+		return 0, nil, err
+	}
+	w.Header().Set("ETag", note.ETag)
+	note.Content = content
+	return http.StatusOK, note, nil
+}
+
+// handleTags counts the notes with each tag, most used first
+func (s *Server) handleTags(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return 0, nil, methodNotAllowed(w, http.MethodGet)
+	}
+	notes, err := s.Manager.ListNotes(nil)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	tags := []TagCount{}
+	for _, t := range manager.CountTags(notes) {
+		tags = append(tags, TagCount{t.Tag, t.Count})
+	}
+	return http.StatusOK, tags, nil
+}
+
+// handleSearch runs the full text search of the search command over the notes
+// matching the tags parameters
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return 0, nil, methodNotAllowed(w, http.MethodGet)
+	}
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		return 0, nil, errorf(http.StatusBadRequest, "Must provide a search query as q")
+	}
+
+	notes, err := s.listNotes(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	idx, err := s.Manager.BuildFullTextIndex(notes)
+	if err != nil {
+		return 0, nil, err
+	}
+	results := []SearchResult{}
+	for _, result := range idx.Search(manager.ParseSearchQuery(q)) {
+		lines := []SearchLine{}
+		for _, line := range result.Lines {
+			lines = append(lines, SearchLine{line.Num + 1, line.Text})
+		}
+		results = append(results, SearchResult{toNote(result.Note), result.Score, lines})
+	}
+	return http.StatusOK, results, nil
+}
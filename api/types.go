@@ -0,0 +1,61 @@
+package api
+
+import "time"
+
+// Note is a note as sent by the api, Content and ETag are only set when a
+// single note is requested or changed. Notes in a notebook are requested as
+// /notes/{notebook}/{title}.
+type Note struct {
+	Id       int       `json:"id"`
+	Title    string    `json:"title"`
+	Notebook string    `json:"notebook,omitempty"`
+	Tags     []string  `json:"tags"`
+	Modified time.Time `json:"modified"`
+	Content  string    `json:"content,omitempty"`
+	ETag     string    `json:"etag,omitempty"`
+}
+
+// NoteList is a page of the notes matching a tag query, Total is the number
+// of notes on every page
+type NoteList struct {
+	Notes  []Note `json:"notes"`
+	Total  int    `json:"total"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+// NewNote is the body of POST /notes. The note is created from the template
+// as with the new command, followed by Content.
+type NewNote struct {
+	Title    string   `json:"title"`
+	Tags     []string `json:"tags"`
+	Template string   `json:"template"`
+	Content  string   `json:"content"`
+}
+
+// NoteUpdate is the body of PUT /notes/{title}, Content replaces the whole
+// note including its header
+type NoteUpdate struct {
+	Content string `json:"content"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+type SearchLine struct {
+	// Lines are numbered from 1
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+type SearchResult struct {
+	Note  Note         `json:"note"`
+	Score float64      `json:"score"`
+	Lines []SearchLine `json:"lines"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
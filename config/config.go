@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+// Profile holds the settings of a notes directory that are personal rather
+// than shared through the settings file of the directory
+type Profile struct {
+	NotesDir string `toml:"notes_dir"`
+	// The editor and its arguments, such as "code --wait"
+	Editor string `toml:"editor"`
+	// Where the html of every note is written, relative to the notes dir
+	HTMLFile           string                `toml:"html_file"`
+	Exports            []manager.Export      `toml:"exports"`
+	MarkdownExtensions []string              `toml:"markdown_extensions"`
+	AutoCommit         *bool                 `toml:"auto_commit"`
+	JournalFormat      string                `toml:"journal_format"`
+	Search             manager.SearchWeights `toml:"search"`
+}
+
+// file is the layout of the config file. Keys at the top level apply to
+// every profile, and each profile overrides the keys it sets.
+type file struct {
+	Profile
+	DefaultProfile string                    `toml:"default_profile"`
+	Profiles       map[string]toml.Primitive `toml:"profiles"`
+}
+
+// Path is ~/.config/note-taker/config.toml, or under $XDG_CONFIG_HOME if it
+// is set
+func Path() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "note-taker", "config.toml")
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
+
+// Load reads the profile called name from the config file at path, or the
+// default profile if name is empty. A missing file gives an empty profile.
+func Load(path string, name string) (Profile, error) {
+	f := file{Profile: Profile{Search: manager.DefaultSearchWeights}}
+	md, err := toml.DecodeFile(path, &f)
+	if os.IsNotExist(err) {
+		if name != "" {
+			return f.Profile, fmt.Errorf("No profile called '%s', there is no config file at '%s'", name, path)
+		}
+		return f.Profile, nil
+	} else if err != nil {
+		return f.Profile, fmt.Errorf("Invalid config file '%s': %v", path, err)
+	}
+
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if _, ok := f.Profiles[name]; name != "" && !ok {
+		names := []string{}
+		for n := range f.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return f.Profile, fmt.Errorf("No profile called '%s', must be one of: %v", name, names)
+	}
+
+	// Every profile is decoded so that mistakes in any of them are found
+	p := f.Profile
+	for n, primitive := range f.Profiles {
+		// Decoding over the top level settings only replaces the keys that
+		// the profile sets
+		decoded := f.Profile
+		if decoded.AutoCommit != nil {
+			// Otherwise the profile would be decoded through the pointer
+			// shared with the top level
+			autoCommit := *decoded.AutoCommit
+			decoded.AutoCommit = &autoCommit
+		}
+		err = md.PrimitiveDecode(primitive, &decoded)
+		if err != nil {
+			return p, fmt.Errorf("Invalid profile '%s' in '%s': %v", n, path, err)
+		}
+		if n == name {
+			p = decoded
+		}
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return p, fmt.Errorf("Unknown key '%s' in '%s'", undecoded[0], path)
+	}
+	p.NotesDir = expandHome(p.NotesDir)
+	return p, nil
+}
+
+// Settings returns the settings of the profile that apply on top of the
+// settings file of the notes directory
+func (p Profile) Settings() manager.Settings {
+	return manager.Settings{
+		Exports:            p.Exports,
+		MarkdownExtensions: p.MarkdownExtensions,
+		AutoCommit:         p.AutoCommit,
+		HTMLFile:           p.HTMLFile,
+		JournalFormat:      p.JournalFormat,
+	}
+}
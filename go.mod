@@ -3,6 +3,7 @@ module github.com/jbrunsting/note-taker
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/gizak/termui/v3 v3.1.0
 	github.com/gosuri/uilive v0.0.4
 	github.com/pkg/term v0.0.0-20190109203006-aa71e9d9e942
@@ -10,4 +11,5 @@ require (
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20190412213103-97732733099d
 	golang.org/x/tools v0.0.0-20200402205330-226fa68e9d42 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
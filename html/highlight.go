@@ -0,0 +1,342 @@
+package html
+
+import (
+	gohtml "html"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	html2md "github.com/russross/blackfriday/v2"
+)
+
+// language describes just enough of a language to pick out its comments,
+// strings, numbers and keywords
+type language struct {
+	keywords      []string
+	builtins      []string
+	lineComments  []string
+	blockComments [][2]string
+	quotes        string
+	// Backslashes only escape within these quotes, Go raw strings and shell
+	// single quotes do not have escapes
+	escapeQuotes string
+	// Words that are followed by a colon are highlighted as keys
+	keys bool
+	// Names starting with a $ are highlighted as builtins
+	variables       bool
+	caseInsensitive bool
+}
+
+var goLanguage = &language{
+	keywords: []string{
+		"break", "case", "chan", "const", "continue", "default", "defer", "else",
+		"fallthrough", "for", "func", "go", "goto", "if", "import", "interface",
+		"map", "package", "range", "return", "select", "struct", "switch", "type", "var",
+	},
+	builtins: []string{
+		"bool", "byte", "complex64", "complex128", "error", "float32", "float64",
+		"int", "int8", "int16", "int32", "int64", "rune", "string", "uint",
+		"uint8", "uint16", "uint32", "uint64", "uintptr", "true", "false", "iota",
+		"nil", "append", "cap", "close", "copy", "delete", "len", "make", "new",
+		"panic", "print", "println", "recover",
+	},
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        "\"'`",
+	escapeQuotes:  "\"'",
+}
+
+var shellLanguage = &language{
+	keywords: []string{
+		"if", "then", "else", "elif", "fi", "for", "while", "until", "do", "done",
+		"case", "esac", "in", "function", "return", "local", "export", "select",
+	},
+	builtins: []string{
+		"echo", "cd", "exit", "read", "set", "unset", "source", "test", "printf",
+		"shift", "eval", "exec", "trap", "true", "false",
+	},
+	lineComments: []string{"#"},
+	quotes:       "\"'",
+	escapeQuotes: "\"",
+	variables:    true,
+}
+
+var sqlLanguage = &language{
+	keywords: []string{
+		"select", "from", "where", "and", "or", "not", "insert", "into", "values",
+		"update", "set", "delete", "create", "table", "drop", "alter", "index",
+		"join", "left", "right", "inner", "outer", "on", "as", "group", "by",
+		"order", "having", "limit", "offset", "distinct", "union", "all", "is",
+		"null", "in", "like", "between", "exists", "case", "when", "then", "else",
+		"end", "primary", "key", "foreign", "references", "default", "with",
+		"asc", "desc", "begin", "commit", "rollback", "view",
+	},
+	builtins: []string{
+		"int", "integer", "bigint", "smallint", "text", "varchar", "char",
+		"boolean", "date", "timestamp", "float", "real", "numeric", "decimal",
+		"count", "sum", "avg", "min", "max", "coalesce", "now", "true", "false",
+	},
+	lineComments:    []string{"--"},
+	blockComments:   [][2]string{{"/*", "*/"}},
+	quotes:          "'\"",
+	caseInsensitive: true,
+}
+
+var yamlLanguage = &language{
+	builtins:     []string{"true", "false", "null", "yes", "no", "on", "off"},
+	lineComments: []string{"#"},
+	quotes:       "\"'",
+	escapeQuotes: "\"",
+	keys:         true,
+}
+
+var jsonLanguage = &language{
+	builtins:     []string{"true", "false", "null"},
+	quotes:       "\"",
+	escapeQuotes: "\"",
+	keys:         true,
+}
+
+var pythonLanguage = &language{
+	keywords: []string{
+		"and", "as", "assert", "async", "await", "break", "class", "continue",
+		"def", "del", "elif", "else", "except", "finally", "for", "from", "global",
+		"if", "import", "in", "is", "lambda", "nonlocal", "not", "or", "pass",
+		"raise", "return", "try", "while", "with", "yield",
+	},
+	builtins: []string{
+		"True", "False", "None", "self", "print", "len", "range", "int", "str",
+		"float", "list", "dict", "set", "tuple", "bool", "open", "super",
+	},
+	lineComments: []string{"#"},
+	quotes:       "\"'",
+	escapeQuotes: "\"'",
+}
+
+var javascriptLanguage = &language{
+	keywords: []string{
+		"async", "await", "break", "case", "catch", "class", "const", "continue",
+		"default", "delete", "do", "else", "export", "extends", "finally", "for",
+		"from", "function", "if", "import", "in", "instanceof", "interface", "let",
+		"new", "of", "return", "switch", "throw", "try", "type", "typeof", "var",
+		"void", "while", "yield",
+	},
+	builtins: []string{
+		"true", "false", "null", "undefined", "this", "console", "Promise",
+		"Array", "Object", "String", "Number", "JSON", "Math", "string", "number",
+		"boolean", "any",
+	},
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        "\"'`",
+	escapeQuotes:  "\"'`",
+}
+
+var cLanguage = &language{
+	keywords: []string{
+		"break", "case", "catch", "class", "const", "continue", "default", "do",
+		"else", "enum", "extends", "final", "for", "if", "implements", "import",
+		"namespace", "new", "package", "private", "protected", "public", "return",
+		"static", "struct", "switch", "this", "throw", "throws", "try", "typedef",
+		"union", "using", "while", "#include", "#define",
+	},
+	builtins: []string{
+		"int", "long", "short", "char", "float", "double", "void", "bool",
+		"boolean", "unsigned", "signed", "auto", "true", "false", "null",
+		"nullptr", "NULL", "String",
+	},
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        "\"'",
+	escapeQuotes:  "\"'",
+}
+
+var languages = map[string]*language{
+	"go":         goLanguage,
+	"golang":     goLanguage,
+	"bash":       shellLanguage,
+	"sh":         shellLanguage,
+	"shell":      shellLanguage,
+	"zsh":        shellLanguage,
+	"console":    shellLanguage,
+	"sql":        sqlLanguage,
+	"yaml":       yamlLanguage,
+	"yml":        yamlLanguage,
+	"json":       jsonLanguage,
+	"python":     pythonLanguage,
+	"py":         pythonLanguage,
+	"javascript": javascriptLanguage,
+	"js":         javascriptLanguage,
+	"typescript": javascriptLanguage,
+	"ts":         javascriptLanguage,
+	"c":          cLanguage,
+	"cpp":        cLanguage,
+	"c++":        cLanguage,
+	"java":       cLanguage,
+}
+
+func contains(words []string, word string, caseInsensitive bool) bool {
+	for _, w := range words {
+		if w == word || (caseInsensitive && strings.EqualFold(w, word)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// isKey reports whether rest starts with the colon that ends a YAML or JSON
+// key, so urls and times are not mistaken for keys
+func isKey(rest string) bool {
+	rest = strings.TrimLeft(rest, " \t")
+	return strings.HasPrefix(rest, ":") && (len(rest) == 1 || unicode.IsSpace(rune(rest[1])))
+}
+
+// wordEnd returns the byte offset of the end of the word starting at i
+func wordEnd(code string, i int) int {
+	for i < len(code) {
+		c, size := utf8.DecodeRuneInString(code[i:])
+		if !isWordRune(c) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// highlightCode escapes code and wraps its comments, strings, numbers and
+// keywords in spans with hl-* classes, code in an unknown language is only
+// escaped
+func highlightCode(lang string, code string) string {
+	l, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return gohtml.EscapeString(code)
+	}
+
+	var out strings.Builder
+	span := func(class string, text string) {
+		out.WriteString("<span class=\"hl-" + class + "\">" + gohtml.EscapeString(text) + "</span>")
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		prev, _ := utf8.DecodeLastRuneInString(code[:i])
+		afterWord := i > 0 && isWordRune(prev)
+		// A # in the middle of a word, or in a variable such as $#, does not
+		// start a comment
+		hashComment := !afterWord && !(i > 0 && prev == '$')
+
+		end := -1
+		for _, start := range l.lineComments {
+			if strings.HasPrefix(rest, start) && (start != "#" || hashComment) {
+				end = strings.Index(rest, "\n")
+				if end == -1 {
+					end = len(rest)
+				}
+				break
+			}
+		}
+		for _, delims := range l.blockComments {
+			if end == -1 && strings.HasPrefix(rest, delims[0]) {
+				end = strings.Index(rest[len(delims[0]):], delims[1])
+				if end == -1 {
+					end = len(rest)
+				} else {
+					end += len(delims[0]) + len(delims[1])
+				}
+			}
+		}
+		if end != -1 {
+			span("comment", rest[:end])
+			i += end
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(rest)
+		j := i + size
+		switch {
+		case strings.ContainsRune(l.quotes, c):
+			escapes := strings.ContainsRune(l.escapeQuotes, c)
+			for j < len(code) && rune(code[j]) != c {
+				if escapes && code[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(code) {
+				j++
+			}
+			if j > len(code) {
+				j = len(code)
+			}
+			class := "string"
+			if l.keys && isKey(code[j:]) {
+				class = "key"
+			}
+			span(class, code[i:j])
+		case unicode.IsDigit(c) && !afterWord:
+			for j < len(code) && (code[j] == '.' || isWordRune(rune(code[j]))) {
+				j++
+			}
+			span("number", code[i:j])
+		case l.variables && c == '$' && j < len(code) && code[j] == '{':
+			if k := strings.IndexByte(code[j:], '}'); k != -1 {
+				j += k + 1
+			} else {
+				j = len(code)
+			}
+			span("builtin", code[i:j])
+		case l.variables && c == '$' && j < len(code) && strings.IndexByte("#?@*!$-", code[j]) != -1:
+			// Special parameters such as $# and $?
+			j++
+			span("builtin", code[i:j])
+		case l.variables && c == '$' && wordEnd(code, j) > j:
+			j = wordEnd(code, j)
+			span("builtin", code[i:j])
+		case isWordRune(c) || (c == '#' && contains(l.keywords, "#include", false)):
+			j = wordEnd(code, j)
+			word := code[i:j]
+			if l.keys && isKey(code[j:]) {
+				span("key", word)
+			} else if contains(l.keywords, word, l.caseInsensitive) {
+				span("keyword", word)
+			} else if contains(l.builtins, word, l.caseInsensitive) {
+				span("builtin", word)
+			} else {
+				out.WriteString(gohtml.EscapeString(word))
+			}
+		default:
+			out.WriteString(gohtml.EscapeString(code[i:j]))
+		}
+		i = j
+	}
+	return out.String()
+}
+
+// highlightRenderer renders fenced code blocks with syntax highlighting and
+// leaves everything else to the wrapped renderer
+type highlightRenderer struct {
+	*html2md.HTMLRenderer
+}
+
+func (r *highlightRenderer) RenderNode(w io.Writer, node *html2md.Node, entering bool) html2md.WalkStatus {
+	if node.Type != html2md.CodeBlock {
+		return r.HTMLRenderer.RenderNode(w, node, entering)
+	}
+
+	lang := ""
+	if fields := strings.Fields(string(node.Info)); len(fields) > 0 {
+		lang = fields[0]
+	}
+	html := "\n<pre><code"
+	if lang != "" {
+		html += " class=\"language-" + gohtml.EscapeString(lang) + "\""
+	}
+	html += ">" + highlightCode(lang, string(node.Literal)) + "</code></pre>\n"
+	io.WriteString(w, html)
+	return html2md.GoToNext
+}
@@ -0,0 +1,98 @@
+package html
+
+import "testing"
+
+func TestHighlightCode(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		lang string
+		code string
+		want string
+	}{
+		{
+			"go",
+			"go",
+			"func f() string { return \"a\\\"b\" } // done",
+			`<span class="hl-keyword">func</span> f() <span class="hl-builtin">string</span> { <span class="hl-keyword">return</span> <span class="hl-string">&#34;a\&#34;b&#34;</span> } <span class="hl-comment">// done</span>`,
+		},
+		{
+			"go raw strings have no escapes",
+			"go",
+			"`raw\\` /* c */ 1.5",
+			"<span class=\"hl-string\">`raw\\`</span> <span class=\"hl-comment\">/* c */</span> <span class=\"hl-number\">1.5</span>",
+		},
+		{
+			"shell",
+			"sh",
+			"echo \"$1\" ${HOME} # comment",
+			`<span class="hl-builtin">echo</span> <span class="hl-string">&#34;$1&#34;</span> <span class="hl-builtin">${HOME}</span> <span class="hl-comment"># comment</span>`,
+		},
+		{
+			"shell special parameters are not comments",
+			"bash",
+			"if [ $# -gt 0 ]; then exit $?; fi",
+			`<span class="hl-keyword">if</span> [ <span class="hl-builtin">$#</span> -gt <span class="hl-number">0</span> ]; <span class="hl-keyword">then</span> <span class="hl-builtin">exit</span> <span class="hl-builtin">$?</span>; <span class="hl-keyword">fi</span>`,
+		},
+		{
+			"shell # inside a word",
+			"sh",
+			"url=a#b",
+			"url=a#b",
+		},
+		{
+			"sql is case insensitive",
+			"sql",
+			"SELECT count(*) FROM notes -- why",
+			`<span class="hl-keyword">SELECT</span> <span class="hl-builtin">count</span>(*) <span class="hl-keyword">FROM</span> notes <span class="hl-comment">-- why</span>`,
+		},
+		{
+			"yaml",
+			"yaml",
+			"key: \"value\" # c\nurl: http://x#y",
+			"<span class=\"hl-key\">key</span>: <span class=\"hl-string\">&#34;value&#34;</span> <span class=\"hl-comment\"># c</span>\n<span class=\"hl-key\">url</span>: http://x#y",
+		},
+		{
+			"json",
+			"json",
+			`{"id": 5, "ok": null}`,
+			`{<span class="hl-key">&#34;id&#34;</span>: <span class="hl-number">5</span>, <span class="hl-key">&#34;ok&#34;</span>: <span class="hl-builtin">null</span>}`,
+		},
+		{
+			"python",
+			"python",
+			"return None  # c",
+			`<span class="hl-keyword">return</span> <span class="hl-builtin">None</span>  <span class="hl-comment"># c</span>`,
+		},
+		{
+			"javascript",
+			"js",
+			"const x = `t` // c",
+			"<span class=\"hl-keyword\">const</span> x = <span class=\"hl-string\">`t`</span> <span class=\"hl-comment\">// c</span>",
+		},
+		{
+			"c",
+			"c",
+			"#include <stdio.h>\nint x = 0;",
+			"<span class=\"hl-keyword\">#include</span> &lt;stdio.h&gt;\n<span class=\"hl-builtin\">int</span> x = <span class=\"hl-number\">0</span>;",
+		},
+		{
+			"unterminated comment and string",
+			"go",
+			"\"open /* x",
+			`<span class="hl-string">&#34;open /* x</span>`,
+		},
+		{
+			"unknown languages are only escaped",
+			"brainfuck",
+			`<b> & "q"`,
+			`&lt;b&gt; &amp; &#34;q&#34;`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := highlightCode(test.lang, test.code)
+			if got != test.want {
+				t.Errorf("highlightCode(%q, %q)\ngot:  %s\nwant: %s", test.lang, test.code, got, test.want)
+			}
+		})
+	}
+}
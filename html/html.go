@@ -2,17 +2,18 @@ package html
 
 import (
 	"fmt"
+	gohtml "html"
 	"io/ioutil"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jbrunsting/note-taker/manager"
-	html2md "github.com/russross/blackfriday/v2"
 )
 
 const (
 	noTagTag    = "untagged"
-	notesDirKey = "$NOTES"
+	notesDirKey = manager.NotesDirKey
 )
 
 func getClass(tag string) string {
@@ -27,58 +28,204 @@ func getClass(tag string) string {
 	return o
 }
 
-func getId(title string) string {
-	return "id_n_" + strings.ReplaceAll(title, " ", "_")
+// notebookClass is the class of the notes in notebook and in the notebooks
+// nested in it. Tag classes never contain a hyphen, so they cannot collide.
+func notebookClass(notebook string) string {
+	return "notebook-" + getClass(strings.ToLower(strings.ReplaceAll(notebook, "/", " ")))
 }
 
-func getToggles(tags []string) string {
+// toggle is a checkbox that filters the notes with a tag or in a notebook
+type toggle struct {
+	Class string
+	Label string
+}
+
+// getId is the id of the element the note with the full name is rendered in
+func getId(name string) string {
+	return manager.NoteAnchor(name)
+}
+
+func anchorHref(name string) string {
+	return "#" + getId(name)
+}
+
+func getToggles(toggles []toggle) string {
 	html := ""
-	for _, tag := range tags {
+	for _, t := range toggles {
 		html += fmt.Sprintf(
 			"<input id=\"id_c_%[1]s\" class=\"%[1]s\" type=\"checkbox\"/>",
-			getClass(tag),
+			t.Class,
 		)
 	}
 	html += "<input id=\"id_dark_mode\" type=\"checkbox\"/>"
 	html += "<div class=\"tag-selector\">"
-	for _, tag := range tags {
+	for _, t := range toggles {
 		html += fmt.Sprintf(
 			"<label for=\"id_c_%s\">%s</label>",
-			getClass(tag),
-			tag,
+			t.Class,
+			gohtml.EscapeString(t.Label),
 		)
 	}
+	html += "<input id=\"id_search\" type=\"search\" placeholder=\"Search\"/>"
 	html += "<label id=\"id_dark_mode_toggle\" for=\"id_dark_mode\">☀</label>"
 	html += "</div>"
 	return html
 }
 
-func removeTags(md string) string {
-	lines := strings.SplitN(md, "\n", 2)
-	firstLine := strings.TrimSpace(lines[0])
-	if len(firstLine) > 0 && firstLine[0] == '[' && firstLine[len(firstLine)-1] == ']' {
-		if len(lines) > 1 {
-			return lines[1]
+// renderLinks replaces [[wiki links]] with links to the note they refer to,
+// links to notes that do not exist are marked as broken
+func renderLinks(md string, notes []manager.Note, href func(name string) string) string {
+	links := manager.FindLinks(md)
+	for i := len(links) - 1; i >= 0; i-- {
+		l := links[i]
+		var replacement string
+		if target, ok := manager.ResolveLink(notes, l.Target); ok {
+			replacement = fmt.Sprintf("[%s](%s)", l.Label, href(target.FullName()))
+		} else {
+			replacement = fmt.Sprintf(
+				"<span class=\"broken-link\" title=\"No note called %s\">%s</span>",
+				gohtml.EscapeString(l.Target),
+				gohtml.EscapeString(l.Label),
+			)
 		}
-		return ""
+		md = md[:l.Start] + replacement + md[l.End:]
 	}
 	return md
 }
 
+func getBacklinks(names []string, href func(name string) string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	html := "<div class=\"backlinks\"><p>Linked from</p>"
+	for _, name := range names {
+		html += fmt.Sprintf("<a href=\"%s\">%s</a>", gohtml.EscapeString(href(name)), gohtml.EscapeString(name))
+	}
+	return html + "</div>"
+}
+
+// getCalendar renders a calendar of every month with journal entries, most
+// recent first, linking each day to its entry
+func getCalendar(notes []manager.Note, format string, href func(name string) string) string {
+	entries := make(map[string]manager.Note)
+	months := []time.Time{}
+	for _, note := range notes {
+		isJournal := false
+		for _, tag := range note.Tags {
+			isJournal = isJournal || strings.ToLower(tag) == manager.JournalTag
+		}
+		date, ok := manager.ParseJournalDate(format, note)
+		if !isJournal || !ok {
+			continue
+		}
+
+		month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if _, ok := entries[month.Format("2006-01")]; !ok {
+			months = append(months, month)
+			entries[month.Format("2006-01")] = manager.Note{}
+		}
+		entries[date.Format("2006-01-02")] = note
+	}
+	if len(months) == 0 {
+		return ""
+	}
+	sort.SliceStable(months, func(i, j int) bool {
+		return months[i].After(months[j])
+	})
+
+	html := "<details class=\"journal-calendar\" open><summary>Journal</summary>"
+	for _, month := range months {
+		html += fmt.Sprintf("<table><caption>%s</caption><tr>", month.Format("January 2006"))
+		for _, day := range []string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"} {
+			html += "<th>" + day + "</th>"
+		}
+		html += "</tr><tr>"
+
+		// Weeks start on Monday, time.Sunday is 0
+		offset := (int(month.Weekday()) + 6) % 7
+		html += strings.Repeat("<td></td>", offset)
+		for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+			if day.Day() != 1 && (int(day.Weekday())+6)%7 == 0 {
+				html += "</tr><tr>"
+			}
+			if note, ok := entries[day.Format("2006-01-02")]; ok {
+				html += fmt.Sprintf("<td><a href=\"%s\">%d</a></td>", gohtml.EscapeString(href(note.FullName())), day.Day())
+			} else {
+				html += fmt.Sprintf("<td>%d</td>", day.Day())
+			}
+		}
+		html += "</tr></table>"
+	}
+	return html + "</details>"
+}
+
 type OrderedTag struct {
 	Tag   string
 	Count int
 }
 
-func GenerateHTML(notes []manager.Note, notesDir string) (string, error) {
+type Options struct {
+	// The layout of journal entry titles, used to place them in the calendar
+	JournalFormat string
+	// The names of the markdown extensions to use, nil for the defaults
+	Extensions []string
+	// Where links to a note point, given the full name of the note, nil
+	// links to the anchor of the note on the page
+	Href func(name string) string
+	// The notes that links and backlinks can refer to, nil for only the
+	// notes on the page
+	LinkNotes []manager.Note
+}
+
+func GenerateHTML(notes []manager.Note, notesDir string, opts Options) (string, error) {
 	sort.SliceStable(notes, func(i, j int) bool {
 		return notes[i].ModTime.After(notes[j].ModTime)
 	})
+	extensions, err := ParseExtensions(opts.Extensions)
+	if err != nil {
+		return "", err
+	}
+
+	href := opts.Href
+	if href == nil {
+		href = anchorHref
+	}
+	linkNotes := opts.LinkNotes
+	if linkNotes == nil {
+		linkNotes = notes
+	}
+
+	contents := make(map[string]string)
+	for _, list := range [][]manager.Note{notes, linkNotes} {
+		for _, note := range list {
+			if _, ok := contents[note.Path]; ok {
+				continue
+			}
+			bmd, err := ioutil.ReadFile(note.Path)
+			if err != nil {
+				return "", err
+			}
+			contents[note.Path] = string(bmd)
+		}
+	}
+	links := manager.BuildLinkGraph(linkNotes, contents)
+
 	oTags := make(map[string]*OrderedTag)
+	notebooks := make(map[string]bool)
 	html := ""
 	for _, note := range notes {
 		tagHtml := "<div class=\"tag\">"
 		classes := ""
+		if note.Notebook != "" {
+			// A note is in its notebook and every notebook above it
+			parts := strings.Split(note.Notebook, "/")
+			for i := range parts {
+				notebook := strings.Join(parts[:i+1], "/")
+				notebooks[notebook] = true
+				classes += " " + notebookClass(notebook)
+			}
+			tagHtml += fmt.Sprintf("<p class=\"notebook\">%s/</p>", gohtml.EscapeString(note.Notebook))
+		}
 		for _, tag := range note.Tags {
 			tag = strings.ToLower(tag)
 
@@ -89,7 +236,7 @@ func GenerateHTML(notes []manager.Note, notesDir string) (string, error) {
 			oTags[tag].Count += 1
 			classes += " " + getClass(tag)
 
-			tagHtml += fmt.Sprintf("<p>%s</p>", tag)
+			tagHtml += fmt.Sprintf("<p>%s</p>", gohtml.EscapeString(tag))
 		}
 		if len(note.Tags) == 0 {
 			oTags[noTagTag] = &OrderedTag{noTagTag, 0}
@@ -97,22 +244,15 @@ func GenerateHTML(notes []manager.Note, notesDir string) (string, error) {
 		}
 		tagHtml += "</div>"
 
-		bmd, err := ioutil.ReadFile(note.Path)
-		if err != nil {
-			return html, err
-		}
-		md := strings.Replace(string(bmd), notesDirKey, notesDir, -1)
-		noteHtml := string(html2md.Run(
-			[]byte(removeTags(md)),
-			html2md.WithNoExtensions(),
-		))
+		noteHtml := renderMarkdown(note, contents[note.Path], linkNotes, notesDir, href, extensions)
 
-		html += fmt.Sprintf("<div class=\"__note__ %s\" id=\"%s\">", classes, getId(note.Title))
+		html += fmt.Sprintf("<div class=\"__note__ %s\" id=\"%s\">", classes, gohtml.EscapeString(getId(note.FullName())))
 		html += "<div class=\"header\">"
-		html += fmt.Sprintf("<a href=\"#%s\" class=\"note-header\">%s</a>", getId(note.Title), note.Title)
+		html += fmt.Sprintf("<a href=\"#%s\" class=\"note-header\">%s</a>", gohtml.EscapeString(getId(note.FullName())), gohtml.EscapeString(note.Title))
 		html += tagHtml
 		html += "</div>"
 		html += noteHtml
+		html += getBacklinks(links.Incoming[note.FullName()], href)
 		html += "</div>"
 	}
 
@@ -125,16 +265,32 @@ func GenerateHTML(notes []manager.Note, notesDir string) (string, error) {
 		return vals[i].Count > vals[j].Count
 	})
 
-	tags := []string{}
+	toggles := []toggle{}
 	for _, ot := range vals {
-		tags = append(tags, ot.Tag)
+		toggles = append(toggles, toggle{getClass(ot.Tag), ot.Tag})
+	}
+	// Notebooks follow the tags in alphabetical order, so nested notebooks
+	// come right after the notebook they are in
+	sortedNotebooks := []string{}
+	for notebook := range notebooks {
+		sortedNotebooks = append(sortedNotebooks, notebook)
+	}
+	sort.Strings(sortedNotebooks)
+	for _, notebook := range sortedNotebooks {
+		toggles = append(toggles, toggle{notebookClass(notebook), notebook + "/"})
 	}
 
-	html = getToggles(tags) + "<div id=\"id_body\"><div id=\"id_content\">" + html + "</div></div>"
-	return "<html>" + getStyle(tags) + "<body>" + html + "</body></html>", nil
+	index, err := getSearchIndex(notes, contents)
+	if err != nil {
+		return "", err
+	}
+
+	html = getCalendar(notes, opts.JournalFormat, href) + html
+	html = getToggles(toggles) + "<div id=\"id_body\"><div id=\"id_content\">" + html + "</div></div>"
+	return "<html>" + getStyle(toggles) + "<body>" + html + index + searchScript + "</body></html>", nil
 }
 
-func getStyle(tags []string) string {
+func getStyle(toggles []toggle) string {
 	// We just make the CSS a big string so we can easily construct a single
 	// html file that displays the notes, without relying on reading from an
 	// external css file
@@ -225,6 +381,24 @@ div.tag-selector {
 	max-width: 800px;
 }
 
+#id_search {
+    display: inline-block;
+    margin: 0px 10px 0px auto;
+    padding: 3px 7px;
+    border: 1px solid #6D9D99;
+    border-radius: 3px;
+    min-width: 120px;
+    font-family: inherit;
+}
+
+#id_search ~ #id_dark_mode_toggle {
+    margin-left: 0px;
+}
+
+.__note__.search-hidden {
+    display: none !important;
+}
+
 #id_dark_mode_toggle {
     margin-right: 0px;
 	margin-left: auto;
@@ -242,6 +416,35 @@ div.tag-selector {
 	max-width: 100%;
 }
 
+.__note__ input[type=checkbox] {
+    display: inline;
+    margin: 0px 5px 0px 0px;
+}
+
+li.task {
+    list-style: none;
+}
+
+.__note__ table {
+    border-collapse: collapse;
+    margin: 5px 0px;
+}
+
+.__note__ th, .__note__ td {
+    padding: 3px 7px;
+    border: 1px solid #BFC9BC;
+}
+
+.__note__ pre {
+    overflow-x: auto;
+    padding: 5px;
+    border-radius: 3px;
+}
+
+.footnotes {
+    font-size: 0.8em;
+}
+
 .__note__ img {
 	max-height: 450px;
 	margin: auto;
@@ -271,6 +474,63 @@ div.tag-selector {
     font-size: 0.8em;
 }
 
+.backlinks {
+    margin-top: 10px;
+    padding-top: 5px;
+    border-top: 1px dashed #2E2E2E;
+    font-size: 0.8em;
+}
+
+.backlinks p {
+    display: inline;
+    margin-right: 5px;
+}
+
+.backlinks a {
+    margin-right: 10px;
+}
+
+.broken-link {
+    text-decoration: line-through;
+    cursor: help;
+}
+
+.journal-calendar {
+    margin: 10px 0px;
+    padding: 10px;
+    border-radius: 3px;
+    box-shadow: 0px 0px 5px rgba(0, 0, 0, 0.5);
+}
+
+.journal-calendar summary {
+    cursor: pointer;
+    font-weight: bold;
+}
+
+.journal-calendar table {
+    display: inline-table;
+    margin: 5px 15px 5px 0px;
+    font-size: 0.8em;
+    border-collapse: collapse;
+}
+
+.journal-calendar caption {
+    margin: 5px 0px;
+}
+
+.journal-calendar td, .journal-calendar th {
+    width: 24px;
+    height: 20px;
+    text-align: center;
+}
+
+.journal-calendar td a {
+    display: block;
+    border-radius: 3px;
+    text-decoration: none;
+    font-weight: bold;
+}
+
 .tag p {
     font-size: 1em;
     display: inline-block;
@@ -295,15 +555,50 @@ label {
     background-color: #FAF8F3;
 }
 
-.__note__ {
+.__note__, .journal-calendar {
     background-color: #FAF8F3;
 }
 
+.__note__ pre {
+    background-color: #F4EFE5;
+}
+
+.hl-keyword {
+    color: #3F6F6B;
+    font-weight: bold;
+}
+
+.hl-string {
+    color: #9C6B3C;
+}
+
+.hl-number {
+    color: #B05A5A;
+}
+
+.hl-comment {
+    color: #8C8C8C;
+    font-style: italic;
+}
+
+.hl-builtin, .hl-key {
+    color: #556b69;
+}
+
+.journal-calendar td a {
+    color: #F4EFE5;
+    background-color: #6D9D99;
+}
+
 .tag p {
 	border: 2px solid;
 	border-color: #6D9D99;
 }
 
+.tag p.notebook {
+	border-style: dashed;
+}
+
 #id_dark_mode:checked ~ #id_body {
     color: #D1D1D1;
     background-color: #05070C;
@@ -313,20 +608,60 @@ label {
     color: #0B101A;
 }
 
+#id_dark_mode:checked ~ .tag-selector #id_search {
+    color: #D1D1D1;
+    background-color: #2E2E2E;
+    border-color: #556b69;
+}
+
 #id_dark_mode:checked ~ .tag-selector #id_dark_mode_toggle {
     color: #D1D1D1;
     background-color: #2E2E2E;
 }
 
-#id_dark_mode:checked ~ #id_body .__note__ {
+#id_dark_mode:checked ~ #id_body .__note__,
+#id_dark_mode:checked ~ #id_body .journal-calendar {
     background-color: #2E2E2E;
 }
 
+#id_dark_mode:checked ~ #id_body .__note__ pre {
+    background-color: #05070C;
+}
+
+#id_dark_mode:checked ~ #id_body .hl-keyword {
+    color: #8FBFBA;
+}
+
+#id_dark_mode:checked ~ #id_body .hl-string {
+    color: #D9A877;
+}
+
+#id_dark_mode:checked ~ #id_body .hl-number {
+    color: #E08A8A;
+}
+
+#id_dark_mode:checked ~ #id_body .hl-comment {
+    color: #7A7A7A;
+}
+
+#id_dark_mode:checked ~ #id_body .hl-builtin,
+#id_dark_mode:checked ~ #id_body .hl-key {
+    color: #A9C4C1;
+}
+
+#id_dark_mode:checked ~ #id_body .journal-calendar td a {
+    color: #0B101A;
+}
+
 #id_dark_mode:checked ~ #id_body .header {
 	border-bottom: 1px solid #FAF8F3;
 }
+
+#id_dark_mode:checked ~ #id_body .backlinks {
+	border-top: 1px dashed #FAF8F3;
+}
 `
-	for _, tag := range tags {
+	for _, t := range toggles {
 		css += fmt.Sprintf(`
 input.%[1]s ~ #id_body div.%[1]s {
     display: none
@@ -341,7 +676,7 @@ input.%[1]s:checked ~ #id_dark_mode:checked ~ div > label[for=id_c_%[1]s] {
 	background-color: #556b69;
 }
 `,
-			getClass(tag),
+			t.Class,
 		)
 	}
 	return "<style>" + css + "</style>"
@@ -0,0 +1,89 @@
+package html
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jbrunsting/note-taker/manager"
+	html2md "github.com/russross/blackfriday/v2"
+)
+
+var extensionNames = map[string]html2md.Extensions{
+	"no-intra-emphasis":   html2md.NoIntraEmphasis,
+	"tables":              html2md.Tables,
+	"fenced-code":         html2md.FencedCode,
+	"autolink":            html2md.Autolink,
+	"strikethrough":       html2md.Strikethrough,
+	"lax-html-blocks":     html2md.LaxHTMLBlocks,
+	"space-headings":      html2md.SpaceHeadings,
+	"hard-line-break":     html2md.HardLineBreak,
+	"tab-size-eight":      html2md.TabSizeEight,
+	"footnotes":           html2md.Footnotes,
+	"no-empty-line":       html2md.NoEmptyLineBeforeBlock,
+	"heading-ids":         html2md.HeadingIDs,
+	"titleblock":          html2md.Titleblock,
+	"auto-heading-ids":    html2md.AutoHeadingIDs,
+	"backslash-linebreak": html2md.BackslashLineBreak,
+	"definition-lists":    html2md.DefinitionLists,
+}
+
+// DefaultExtensions are the GitHub style extensions along with footnotes
+const DefaultExtensions = html2md.CommonExtensions | html2md.Footnotes
+
+var taskPattern = regexp.MustCompile(`<li>(<p>)?\[([ xX])\]\s`)
+
+// ParseExtensions returns the markdown extensions with the given names, nil
+// gives the default extensions
+func ParseExtensions(names []string) (html2md.Extensions, error) {
+	if names == nil {
+		return DefaultExtensions, nil
+	}
+
+	extensions := html2md.NoExtensions
+	for _, name := range names {
+		e, ok := extensionNames[name]
+		if !ok {
+			valid := []string{}
+			for n := range extensionNames {
+				valid = append(valid, n)
+			}
+			sort.Strings(valid)
+			return extensions, fmt.Errorf("Unknown markdown extension '%s', must be one of: %v", name, valid)
+		}
+		extensions |= e
+	}
+	return extensions, nil
+}
+
+// renderTasks turns list items starting with [ ] or [x] into checkboxes
+func renderTasks(html string) string {
+	return taskPattern.ReplaceAllStringFunc(html, func(item string) string {
+		match := taskPattern.FindStringSubmatch(item)
+		checked := ""
+		if match[2] != " " {
+			checked = " checked"
+		}
+		return fmt.Sprintf("<li class=\"task\">%s<input type=\"checkbox\" disabled%s/> ", match[1], checked)
+	})
+}
+
+// renderMarkdown renders the body of a note, with links to other notes
+// pointing at href(name) for the full name of the note
+func renderMarkdown(note manager.Note, content string, notes []manager.Note, notesDir string, href func(name string) string, extensions html2md.Extensions) string {
+	md := strings.Replace(content, notesDirKey, notesDir, -1)
+	md = renderLinks(manager.StripHeader(md), notes, href)
+
+	// Footnotes are prefixed with the note so that the footnotes of
+	// different notes on the same page do not collide
+	renderer := &highlightRenderer{html2md.NewHTMLRenderer(html2md.HTMLRendererParameters{
+		Flags:                html2md.CommonHTMLFlags,
+		FootnoteAnchorPrefix: getId(note.FullName()) + "-",
+	})}
+	return renderTasks(string(html2md.Run(
+		[]byte(md),
+		html2md.WithRenderer(renderer),
+		html2md.WithExtensions(extensions),
+	)))
+}
@@ -0,0 +1,73 @@
+package html
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata with the current output")
+
+// The notes that [[links]] in the golden inputs can refer to
+var goldenNotes = []manager.Note{
+	{Id: 5, Title: "Other"},
+	{Id: 6, Title: "Plan", Notebook: "projects"},
+	{Id: 7, Title: "Other", Notebook: "projects"},
+}
+
+// TestRenderMarkdownGolden renders every testdata/markdown/<name>.md with the
+// default extensions and compares it to testdata/markdown/<name>.html
+func TestRenderMarkdownGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "markdown", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("No golden inputs in testdata/markdown")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".md")
+		t.Run(name, func(t *testing.T) {
+			content, err := ioutil.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			note := manager.Note{Title: name}
+			got := renderMarkdown(note, string(content), goldenNotes, "/notes", anchorHref, DefaultExtensions)
+
+			golden := strings.TrimSuffix(input, ".md") + ".html"
+			if *update {
+				if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run the tests with -update to create it", err)
+			}
+			if got != string(want) {
+				t.Errorf("%s does not match %s, run the tests with -update if the change is intended\ngot:\n%s", input, golden, got)
+			}
+		})
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	extensions, err := ParseExtensions(nil)
+	if err != nil || extensions != DefaultExtensions {
+		t.Errorf("ParseExtensions(nil) returned %v, %v", extensions, err)
+	}
+	extensions, err = ParseExtensions([]string{"tables", "footnotes"})
+	if err != nil || extensions != extensionNames["tables"]|extensionNames["footnotes"] {
+		t.Errorf("ParseExtensions returned %v, %v", extensions, err)
+	}
+	if _, err := ParseExtensions([]string{"tables", "nope"}); err == nil {
+		t.Errorf("ParseExtensions should reject unknown extensions")
+	}
+}
@@ -0,0 +1,77 @@
+package html
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+// searchEntry is the index of a single note, kept small since the index of
+// every note is embedded in the page
+type searchEntry struct {
+	Id    string `json:"i"`
+	Title string `json:"t"`
+	// The distinct words of the note, lower cased and space separated
+	Words string `json:"w"`
+}
+
+func searchWords(content string) string {
+	seen := make(map[string]bool)
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(content), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// getSearchIndex returns a script element holding the search index of the
+// notes as JSON, contents holds the content of each note by path
+func getSearchIndex(notes []manager.Note, contents map[string]string) (string, error) {
+	entries := []searchEntry{}
+	for _, note := range notes {
+		entries = append(entries, searchEntry{
+			Id:    getId(note.FullName()),
+			Title: strings.ToLower(note.Title),
+			Words: searchWords(note.Title + " " + manager.StripHeader(contents[note.Path])),
+		})
+	}
+	// The json package escapes <, > and &, so the index cannot close the
+	// script element early
+	index, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	return "<script id=\"id_search_index\" type=\"application/json\">" + string(index) + "</script>", nil
+}
+
+// searchScript hides the notes that do not match every word typed into the
+// search box, a word matches if it is part of the title or the start of a
+// word in the note. Hiding is done with a class so it combines with the tag
+// toggles.
+const searchScript = `<script>
+(function() {
+    var index = JSON.parse(document.getElementById("id_search_index").textContent);
+    var search = document.getElementById("id_search");
+    search.addEventListener("input", function() {
+        var terms = search.value.toLowerCase().split(/[^\p{L}\p{N}]+/u).filter(function(t) {
+            return t.length > 0;
+        });
+        index.forEach(function(entry) {
+            var words = " " + entry.w;
+            var matches = terms.every(function(t) {
+                return entry.t.indexOf(t) !== -1 || words.indexOf(" " + t) !== -1;
+            });
+            document.getElementById(entry.i).classList.toggle("search-hidden", !matches);
+        });
+    });
+})();
+</script>`
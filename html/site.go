@@ -0,0 +1,281 @@
+package html
+
+import (
+	"fmt"
+	gohtml "html"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+const (
+	siteNotesDir  = "notes"
+	siteTagsDir   = "tags"
+	siteAssetsDir = "assets"
+	siteStyleFile = "style.css"
+)
+
+var notesDirRefPattern = regexp.MustCompile(regexp.QuoteMeta(notesDirKey) + `/([^\s)"'<>]+)`)
+
+// slugs gives each name a file name that is safe to use in a url, adding a
+// suffix to names that would otherwise share one
+func slugs(names []string) map[string]string {
+	out := make(map[string]string)
+	used := make(map[string]bool)
+	for _, name := range names {
+		slug := ""
+		for _, c := range strings.ToLower(name) {
+			if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+				slug += string(c)
+			} else if !strings.HasSuffix(slug, "-") {
+				slug += "-"
+			}
+		}
+		slug = strings.Trim(slug, "-")
+		if slug == "" {
+			slug = "note"
+		}
+
+		unique := slug
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s-%d", slug, i)
+		}
+		used[unique] = true
+		out[name] = unique
+	}
+	return out
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// copyAssets copies every file in the notes directory that content refers to
+// with $NOTES/ into the assets directory of the site
+func copyAssets(content string, notesDir string, outDir string) error {
+	for _, match := range notesDirRefPattern.FindAllStringSubmatch(content, -1) {
+		ref, err := url.PathUnescape(match[1])
+		if err != nil {
+			ref = match[1]
+		}
+		ref = filepath.Clean(ref)
+		if strings.HasPrefix(ref, "..") || filepath.IsAbs(ref) {
+			continue
+		}
+
+		src := filepath.Join(notesDir, ref)
+		if info, err := os.Stat(src); err != nil || info.IsDir() {
+			// Missing files are left as broken links, as in the single
+			// page output
+			continue
+		}
+		err = copyFile(src, filepath.Join(outDir, siteAssetsDir, ref))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sitePage wraps the body of a page of the site, root is the relative path
+// from the page to the root of the site so the site can be served from any
+// path
+func sitePage(title string, root string, nav string, body string) string {
+	html := "<html><head><meta charset=\"utf-8\">"
+	html += fmt.Sprintf("<title>%s</title>", gohtml.EscapeString(title))
+	html += fmt.Sprintf("<link rel=\"stylesheet\" href=\"%s%s\">", root, siteStyleFile)
+	html += "</head><body>"
+	html += "<input id=\"id_dark_mode\" type=\"checkbox\"/>"
+	html += "<div class=\"tag-selector\">"
+	html += fmt.Sprintf("<a class=\"site-link\" href=\"%sindex.html\">All notes</a>", root)
+	html += nav
+	html += "<label id=\"id_dark_mode_toggle\" for=\"id_dark_mode\">☀</label>"
+	html += "</div>"
+	html += "<div id=\"id_body\"><div id=\"id_content\">" + body + "</div></div>"
+	return html + "</body></html>"
+}
+
+func siteNoteTags(note manager.Note, tagHref func(tag string) string) string {
+	html := "<div class=\"tag\">"
+	for _, tag := range note.Tags {
+		tag = strings.ToLower(tag)
+		html += fmt.Sprintf("<a href=\"%s\"><p>%s</p></a>", gohtml.EscapeString(tagHref(tag)), gohtml.EscapeString(tag))
+	}
+	return html + "</div>"
+}
+
+// siteList renders a card for each note linking to its page
+func siteList(notes []manager.Note, noteHref func(name string) string, tagHref func(tag string) string) string {
+	html := ""
+	for _, note := range notes {
+		html += "<div class=\"__note__\"><div class=\"header\">"
+		html += fmt.Sprintf("<a href=\"%s\" class=\"note-header\">%s</a>", noteHref(note.FullName()), gohtml.EscapeString(note.Title))
+		html += siteNoteTags(note, tagHref)
+		html += "</div>"
+		html += fmt.Sprintf("<p class=\"note-date\">%s</p>", note.ModTime.Format("2006/01/02 15:04"))
+		html += "</div>"
+	}
+	return html
+}
+
+// GenerateSite writes a page for every note, a page for every tag and an
+// index of every note to outDir, with all links between pages relative
+func GenerateSite(notes []manager.Note, notesDir string, outDir string, opts Options) error {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].ModTime.After(notes[j].ModTime)
+	})
+	extensions, err := ParseExtensions(opts.Extensions)
+	if err != nil {
+		return err
+	}
+
+	contents := make(map[string]string)
+	names := []string{}
+	tagNotes := make(map[string][]manager.Note)
+	for _, note := range notes {
+		bmd, err := ioutil.ReadFile(note.Path)
+		if err != nil {
+			return err
+		}
+		contents[note.Path] = string(bmd)
+		names = append(names, note.FullName())
+		for _, tag := range note.Tags {
+			tag = strings.ToLower(tag)
+			tagNotes[tag] = append(tagNotes[tag], note)
+		}
+	}
+	links := manager.BuildLinkGraph(notes, contents)
+
+	tags := []string{}
+	for tag := range tagNotes {
+		tags = append(tags, tag)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if len(tagNotes[tags[i]]) == len(tagNotes[tags[j]]) {
+			return tags[i] < tags[j]
+		}
+		return len(tagNotes[tags[i]]) > len(tagNotes[tags[j]])
+	})
+
+	// Notes are named by notebook as well as title, so notes with the same
+	// title in different notebooks get their own pages
+	noteSlugs := slugs(names)
+	tagSlugs := slugs(tags)
+	// Every page other than the index is one directory below the root
+	noteHref := func(name string) string {
+		return "../" + siteNotesDir + "/" + noteSlugs[name] + ".html"
+	}
+	tagHref := func(tag string) string {
+		return "../" + siteTagsDir + "/" + url.PathEscape(tagSlugs[tag]) + ".html"
+	}
+	fromRoot := func(href string) string {
+		return strings.TrimPrefix(href, "../")
+	}
+
+	write := func(path string, content string) error {
+		path = filepath.Join(outDir, path)
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, []byte(content), 0644)
+	}
+
+	err = write(siteStyleFile, strings.TrimSuffix(strings.TrimPrefix(getStyle([]toggle{}), "<style>"), "</style>")+siteStyle)
+	if err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		err = copyAssets(contents[note.Path], notesDir, outDir)
+		if err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("<div class=\"__note__\" id=\"%s\">", gohtml.EscapeString(getId(note.FullName())))
+		body += "<div class=\"header\">"
+		body += fmt.Sprintf("<a href=\"%s\" class=\"note-header\">%s</a>", noteHref(note.FullName()), gohtml.EscapeString(note.Title))
+		body += siteNoteTags(note, tagHref)
+		body += "</div>"
+		body += renderMarkdown(note, contents[note.Path], notes, "../"+siteAssetsDir, noteHref, extensions)
+		body += getBacklinks(links.Incoming[note.FullName()], noteHref)
+		body += "</div>"
+
+		err = write(fromRoot(noteHref(note.FullName())), sitePage(note.Title, "../", "", body))
+		if err != nil {
+			return err
+		}
+	}
+
+	nav := ""
+	for _, tag := range tags {
+		nav += fmt.Sprintf("<a class=\"site-link\" href=\"%s\">%s</a>", gohtml.EscapeString(fromRoot(tagHref(tag))), gohtml.EscapeString(tag))
+
+		body := fmt.Sprintf("<h1>#%s</h1>", gohtml.EscapeString(tag))
+		body += siteList(tagNotes[tag], noteHref, tagHref)
+		err = write(fromRoot(tagHref(tag)), sitePage("#"+tag, "../", "", body))
+		if err != nil {
+			return err
+		}
+	}
+
+	rootNoteHref := func(name string) string {
+		return fromRoot(noteHref(name))
+	}
+	rootTagHref := func(tag string) string {
+		return fromRoot(tagHref(tag))
+	}
+	body := getCalendar(notes, opts.JournalFormat, rootNoteHref)
+	body += siteList(notes, rootNoteHref, rootTagHref)
+	return write("index.html", sitePage("Notes", "", nav, body))
+}
+
+const siteStyle = `
+.site-link {
+    margin: 0px 10px 0px 0px;
+    padding: 3px 7px;
+    border-radius: 3px;
+    white-space: nowrap;
+    text-decoration: none;
+    color: #F4EFE5;
+    background-color: #6D9D99;
+}
+
+.tag a {
+    text-decoration: none;
+    color: inherit;
+}
+
+.note-date {
+    font-size: 0.8em;
+    margin-top: 7px;
+}
+
+#id_dark_mode:checked ~ .tag-selector .site-link {
+    color: #0B101A;
+}
+`
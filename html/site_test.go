@@ -0,0 +1,33 @@
+package html
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+func TestTagsAreEscaped(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Note.md")
+	if err := ioutil.WriteFile(path, []byte("body\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notes := []manager.Note{{Id: 1, Title: "Note", Tags: []string{"<b>&x"}, Path: path}}
+
+	html := siteNoteTags(notes[0], func(tag string) string { return "tags/a\"b.html" })
+	want := `<div class="tag"><a href="tags/a&#34;b.html"><p>&lt;b&gt;&amp;x</p></a></div>`
+	if html != want {
+		t.Errorf("siteNoteTags returned %s, want %s", html, want)
+	}
+
+	page, err := GenerateHTML(notes, dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(page, "<b>&x") || !strings.Contains(page, "<p>&lt;b&gt;&amp;x</p>") {
+		t.Errorf("The tag is not escaped in the html of every note")
+	}
+}
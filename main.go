@@ -2,18 +2,28 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/jbrunsting/note-taker/api"
+	"github.com/jbrunsting/note-taker/config"
 	"github.com/jbrunsting/note-taker/html"
 	"github.com/jbrunsting/note-taker/manager"
 	"github.com/jbrunsting/note-taker/request"
+	"github.com/jbrunsting/note-taker/server"
 	"github.com/jbrunsting/note-taker/ui"
+	"github.com/jbrunsting/note-taker/vcs"
 )
 
 const readmeString = `
@@ -29,31 +39,462 @@ func defaultNotesDir() string {
 	return path
 }
 
-func saveAsHTML(m *manager.Manager, tags []string, notesDir string, filepath string) {
-	notes, err := m.ListNotes(tags)
+func tagQuery(tags []string) manager.TagQuery {
+	query, err := manager.ParseTagQueries(tags)
 	if err != nil {
-		log.Fatalf("TODO: Error '%v'", err)
+		log.Fatalf("%v", err)
+	}
+	return query
+}
+
+func loadHTMLOptions(m *manager.Manager) (html.Options, error) {
+	settings, err := m.LoadSettings()
+	if err != nil {
+		return html.Options{}, err
+	}
+	return html.Options{
+		JournalFormat: settings.JournalFormat,
+		Extensions:    settings.MarkdownExtensions,
+	}, nil
+}
+
+func htmlOptions(m *manager.Manager) html.Options {
+	opts, err := loadHTMLOptions(m)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return opts
+}
+
+// writeHTML writes the notes matching the query to a single html file
+func writeHTML(m *manager.Manager, query manager.TagQuery, notesDir string, filepath string) error {
+	notes, err := m.ListNotes(query)
+	if err != nil {
+		return err
 	}
 	manager.SortNotesById(notes)
-	o, err := html.GenerateHTML(notes, notesDir)
+	opts, err := loadHTMLOptions(m)
+	if err != nil {
+		return err
+	}
+	// Links are resolved against every note, so a link to a note that the
+	// query leaves out is not shown as broken
+	all := *m
+	all.Notebook = ""
+	opts.LinkNotes, err = all.ListNotes(nil)
+	if err != nil {
+		return err
+	}
+	o, err := html.GenerateHTML(notes, notesDir, opts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath, []byte(o), 0644)
+}
+
+func saveAsHTML(m *manager.Manager, query manager.TagQuery, notesDir string, filepath string) {
+	err := writeHTML(m, query, notesDir, filepath)
 	if err != nil {
 		// TODO: Add err check function that logs error nicely
 		log.Fatalf("TODO: Error '%v'", err)
 	}
-	if ioutil.WriteFile(filepath, []byte(o), 0644) != nil {
+}
+
+// writeAllHTML writes the html file with every note, index.html unless the
+// settings say otherwise, along with every export in the settings
+func writeAllHTML(m *manager.Manager, notesDir string) error {
+	settings, err := m.LoadSettings()
+	if err != nil {
+		return err
+	}
+
+	// The html files have the notes of every notebook, whichever notebook
+	// the command was run in
+	all := *m
+	all.Notebook = ""
+	err = writeHTML(&all, nil, notesDir, m.HTMLPath(settings))
+	if err != nil {
+		return err
+	}
+	for _, e := range settings.Exports {
+		query, err := manager.ParseTagQueries([]string{e.Tags})
+		if err != nil {
+			return err
+		}
+		err = writeHTML(&all, query, notesDir, m.ExportPath(e))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// regenerateHTML runs writeAllHTML, exiting if it fails
+func regenerateHTML(m *manager.Manager, notesDir string) {
+	err := writeAllHTML(m, notesDir)
+	if err != nil {
 		log.Fatalf("TODO: Error '%v'", err)
 	}
 }
 
+// notebookDir cleans the notebook flag, which must be a directory inside the
+// notes directory
+func notebookDir(notebook string) string {
+	if notebook == "" {
+		return ""
+	}
+	notebook = filepath.ToSlash(filepath.Clean(notebook))
+	if filepath.IsAbs(notebook) || notebook == ".." || strings.HasPrefix(notebook, "../") {
+		log.Fatalf("Notebook '%s' must be a directory inside the notes directory", notebook)
+	}
+	if strings.HasPrefix(notebook, ".") || strings.Contains(notebook, "/.") {
+		log.Fatalf("Notebook '%s' may not be the notes directory or a dot directory", notebook)
+	}
+	return notebook
+}
+
+// checkTitle exits unless a title given on the command line, which may start
+// with notebooks, names a note inside the notes directory, its notebook is
+// checked as notebookDir checks the notebook flag
+func checkTitle(notebook string, title string) {
+	if filepath.IsAbs(title) {
+		log.Fatalf("Note '%s' must be inside the notes directory", title)
+	}
+	full := path.Join(notebook, filepath.ToSlash(title))
+	if full == ".." || strings.HasPrefix(full, "../") {
+		log.Fatalf("Note '%s' must be inside the notes directory", title)
+	}
+	if dir := path.Dir(full); dir != "." {
+		notebookDir(dir)
+	}
+}
+
+func gitRepo(notesDir string) *vcs.Repo {
+	return &vcs.Repo{Dir: notesDir, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+}
+
+// exitOnGitError exits with the exit code of git if it failed, git has
+// already written why to stderr
+func exitOnGitError(err error) {
+	if e, ok := err.(*vcs.Error); ok {
+		os.Exit(e.ExitCode)
+	} else if err != nil {
+		log.Fatalf("Got error: '%v'", err)
+	}
+}
+
+func commitMessage() string {
+	return time.Now().Format("2006.01.02 15:04:05")
+}
+
+// noteLabel describes a note in commit messages, such as "Kubernetes Notes
+// (@42)"
+func noteLabel(m *manager.Manager, title string) string {
+	notes, err := m.ListNotes(nil)
+	if err != nil {
+		log.Fatalf("TODO: Error '%v'", err)
+	}
+	for _, note := range notes {
+		if m.NoteName(note) == title && note.Id != -1 {
+			return fmt.Sprintf("%s (@%d)", title, note.Id)
+		}
+	}
+	return title
+}
+
+// listedNote is a note as printed by the list command
+type listedNote struct {
+	Id       int       `json:"id"`
+	Title    string    `json:"title"`
+	Notebook string    `json:"notebook,omitempty"`
+	Tags     []string  `json:"tags"`
+	Path     string    `json:"path"`
+	Modified time.Time `json:"modified"`
+}
+
+// printNotes writes the notes to stdout as a table, JSON, CSV or one path per
+// line
+func printNotes(m *manager.Manager, notes []manager.Note, format string) error {
+	if format == "paths" {
+		for _, note := range notes {
+			fmt.Println(note.Path)
+		}
+		return nil
+	} else if format == "json" {
+		listed := []listedNote{}
+		for _, note := range notes {
+			tags := note.Tags
+			if tags == nil {
+				tags = []string{}
+			}
+			listed = append(listed, listedNote{note.Id, note.Title, note.Notebook, tags, note.Path, note.ModTime})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(listed)
+	} else if format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"id", "title", "notebook", "tags", "path", "modified"})
+		for _, note := range notes {
+			w.Write([]string{
+				strconv.Itoa(note.Id),
+				note.Title,
+				note.Notebook,
+				strings.Join(note.Tags, " "),
+				note.Path,
+				note.ModTime.Format(time.RFC3339),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID\tTITLE\tTAGS\tMODIFIED\tPATH\n")
+	for _, note := range notes {
+		id := "-"
+		if note.Id != -1 {
+			id = fmt.Sprintf("@%d", note.Id)
+		}
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			id,
+			m.NoteName(note),
+			strings.Join(note.Tags, " "),
+			note.ModTime.Format("2006/01/02 15:04:05"),
+			note.Path,
+		)
+	}
+	return w.Flush()
+}
+
+// headerLines splits a header into lines, each keeping its newline
+func headerLines(header string) []string {
+	lines := strings.SplitAfter(header, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// printHeaderDiff prints the change to the header of a note as a unified
+// diff, the header is always at the start of the note
+func printHeaderDiff(notesDir string, c manager.TagChange) {
+	path, err := filepath.Rel(notesDir, c.Note.Path)
+	if err != nil {
+		path = c.Note.Path
+	}
+	oldLines := headerLines(c.OldHeader)
+	newLines := headerLines(c.NewHeader)
+	fmt.Printf("--- a/%s\n+++ b/%s\n", path, path)
+	fmt.Printf("@@ -1,%d +1,%d @@\n", len(oldLines), len(newLines))
+	for _, line := range oldLines {
+		printDiffLine("-", line)
+	}
+	for _, line := range newLines {
+		printDiffLine("+", line)
+	}
+}
+
+func printDiffLine(prefix string, line string) {
+	if strings.HasSuffix(line, "\n") {
+		fmt.Print(prefix + line)
+	} else {
+		// The header is the whole note
+		fmt.Printf("%s%s\n\\ No newline at end of file\n", prefix, line)
+	}
+}
+
+// autoCommit commits the files the command changed through the manager, the
+// changed files given, and the regenerated html as a single commit if
+// auto_commit is set in the settings, doing nothing if the notes directory is
+// not a git repository. Other changes in the notes directory are left alone.
+func autoCommit(m *manager.Manager, notesDir string, message string, changed ...string) {
+	settings, err := m.LoadSettings()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if !settings.AutoCommitEnabled() {
+		return
+	}
+	repo := gitRepo(notesDir)
+	repo.Stdout = nil
+	if !repo.IsRepo() {
+		return
+	}
+
+	paths := append(m.ChangedFiles(), changed...)
+	html := []string{m.HTMLPath(settings)}
+	for _, e := range settings.Exports {
+		html = append(html, m.ExportPath(e))
+	}
+	for _, h := range html {
+		// Html written outside of the notes directory is not committed
+		rel, err := filepath.Rel(notesDir, h)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+	}
+	_, err = repo.CommitPaths(message, paths)
+	exitOnGitError(err)
+}
+
+func hasConflictMarkers(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "<<<<<<<") || strings.HasPrefix(line, ">>>>>>>") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflicts opens each conflicted note in the editor until its
+// conflict markers are gone, and regenerates conflicted html files since
+// they are built from the notes. Conflicts in any other file are left to the
+// user.
+func resolveConflicts(m *manager.Manager, repo *vcs.Repo, notesDir string, conflicts []string) error {
+	html := []string{}
+	for _, f := range conflicts {
+		if strings.HasSuffix(f, ".html") {
+			html = append(html, f)
+			continue
+		} else if !strings.HasSuffix(f, ".md") {
+			return fmt.Errorf("Cannot resolve the conflict in '%s'", f)
+		}
+
+		for {
+			err := m.EditFile(notesDir + "/" + f)
+			if err != nil {
+				return err
+			}
+			content, err := ioutil.ReadFile(notesDir + "/" + f)
+			if err != nil {
+				return err
+			}
+			if !hasConflictMarkers(string(content)) {
+				break
+			}
+
+			reader := bufio.NewReader(os.Stdin)
+			fmt.Printf("%s still has conflict markers, edit it again (y/n): ", f)
+			text, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(text) != "y" {
+				return fmt.Errorf("Conflict markers remain in '%s'", f)
+			}
+		}
+		err := repo.Run("add", "--", f)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(html) > 0 {
+		err := writeAllHTML(m, notesDir)
+		if err != nil {
+			return err
+		}
+		return repo.Run(append([]string{"add", "--"}, html...)...)
+	}
+	return nil
+}
+
+// syncNotes commits local changes, rebases them onto or merges them with the
+// upstream branch, resolving any conflicts, and pushes the result. Errors
+// from git are returned as a *vcs.Error.
+func syncNotes(m *manager.Manager, repo *vcs.Repo, notesDir string, merge bool) error {
+	committed, err := repo.CommitAll(commitMessage())
+	if err != nil {
+		return err
+	}
+	if committed {
+		fmt.Printf("Committed local changes\n")
+	}
+
+	err = repo.Run("fetch")
+	if err != nil {
+		return err
+	}
+	incoming, err := repo.Count("HEAD..@{upstream}")
+	if err != nil {
+		return err
+	}
+
+	if incoming > 0 {
+		op := "rebase"
+		continueCmd := []string{"-c", "core.editor=true", "rebase", "--continue"}
+		if merge {
+			op = "merge"
+			err = repo.Run("merge", "--no-edit", "@{upstream}")
+			continueCmd = []string{"commit", "--no-edit"}
+		} else {
+			err = repo.Run("rebase", "@{upstream}")
+		}
+		// A rebase stops once for every local commit that conflicts
+		for err != nil {
+			conflicts, cerr := repo.Conflicts()
+			if cerr != nil {
+				return cerr
+			}
+			if len(conflicts) == 0 {
+				return err
+			}
+
+			fmt.Printf("Resolving conflicts in: %s\n", strings.Join(conflicts, ", "))
+			rerr := resolveConflicts(m, repo, notesDir, conflicts)
+			if rerr != nil {
+				return fmt.Errorf(
+					"%v\nResolve the conflicts and run 'git %s --continue', or run 'git %s --abort', in %s",
+					rerr, op, op, notesDir,
+				)
+			}
+			err = repo.Run(continueCmd...)
+		}
+		fmt.Printf("Pulled %d commits\n", incoming)
+	}
+
+	outgoing, err := repo.Count("@{upstream}..HEAD")
+	if err != nil {
+		return err
+	}
+	if outgoing > 0 {
+		err = repo.Run("push")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pushed %d commits\n", outgoing)
+	}
+	if incoming == 0 && outgoing == 0 {
+		fmt.Printf("Already up to date\n")
+	}
+	return nil
+}
+
 func main() {
 	r := request.RequestFromArgs()
 
+	profile, err := config.Load(config.Path(), r.Profile)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if r.NotesDir == "" {
+		r.NotesDir = profile.NotesDir
+	}
 	if r.NotesDir == "" {
 		r.NotesDir = defaultNotesDir()
 	}
 
-	m := manager.Manager{r.NotesDir}
-	u := ui.UI{&m}
+	m := manager.Manager{
+		Dir:          r.NotesDir,
+		Notebook:     notebookDir(r.Notebook),
+		Editor:       strings.Fields(profile.Editor),
+		Search:       &profile.Search,
+		UserSettings: profile.Settings(),
+	}
+	u := ui.UI{Manager: &m}
 
 	if r.Cmd == request.NEW {
 		if r.NewArgs == nil {
@@ -62,24 +503,26 @@ func main() {
 		if strings.Contains(r.NewArgs.Title, "_") {
 			log.Fatalf("Title may not contain any underscores")
 		}
+		checkTitle(m.Notebook, r.NewArgs.Title)
+		for _, tag := range r.NewArgs.Tags {
+			if err := manager.ValidateTag(tag); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
 
-		notes, err := m.ListNotes([]string{})
-		if err != nil {
-			log.Fatalf("TODO: Error '%v'", err)
+		content := func(id int) (string, error) {
+			return m.NoteContent(r.NewArgs.Template, id, r.NewArgs.Title, r.NewArgs.Tags)
 		}
-		// TODO: Should read notes to get highest ID
-		header := fmt.Sprintf("[@%d", len(notes)+1)
-		if len(r.NewArgs.Tags) != 0 {
-			for _, tag := range r.NewArgs.Tags {
-				header += ", #" + tag
-			}
+		title, err := m.Create(r.NewArgs.Title, content)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
 		}
-		header += "]\n"
-		err = m.CreateAndEdit(r.NewArgs.Title, header)
+		err = m.Edit(title)
 		if err != nil {
 			log.Fatalf("Got error: '%v'", err)
 		}
-		saveAsHTML(&m, r.NewArgs.Tags, r.NotesDir, r.NotesDir+"/index.html")
+		regenerateHTML(&m, r.NotesDir)
+		autoCommit(&m, r.NotesDir, "new: "+noteLabel(&m, title))
 	} else if r.Cmd == request.MV {
 		if r.MvArgs == nil {
 			log.Fatalf("TODO: No image thing")
@@ -90,16 +533,23 @@ func main() {
 		if strings.Contains(r.MvArgs.Title, "_") {
 			log.Fatalf("Title may not contain any underscores")
 		}
+		checkTitle(m.Notebook, r.MvArgs.Title)
 		components := strings.Split(r.MvArgs.Src, ".")
-		m.Move(r.MvArgs.Src, r.MvArgs.Title, components[len(components)-1])
+		err := m.Move(r.MvArgs.Src, r.MvArgs.Title, components[len(components)-1])
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		autoCommit(&m, r.NotesDir, fmt.Sprintf("mv: %s to %s", filepath.Base(r.MvArgs.Src), r.MvArgs.Title))
 	} else if r.Cmd == request.EDIT {
 		if r.EditArgs == nil {
 			log.Fatalf("TODO: error message, shouldn't get here")
 		}
 
 		title := r.EditArgs.Title
-		if title == "" {
-			notes, err := m.ListNotes(r.EditArgs.Tags)
+		if title != "" {
+			checkTitle(m.Notebook, title)
+		} else {
+			notes, err := m.ListNotes(tagQuery(r.EditArgs.Tags))
 			if err != nil {
 				log.Fatalf("TODO: Error '%v'", err)
 			}
@@ -117,7 +567,8 @@ func main() {
 		if err != nil {
 			log.Fatalf("Got error: '%v'", err)
 		}
-		saveAsHTML(&m, []string{}, r.NotesDir, r.NotesDir+"/index.html")
+		regenerateHTML(&m, r.NotesDir)
+		autoCommit(&m, r.NotesDir, "edit: "+noteLabel(&m, title))
 	} else if r.Cmd == request.DELETE {
 		if r.DeleteArgs == nil {
 			log.Fatalf("TODO: error message, shouldn't get here")
@@ -127,6 +578,7 @@ func main() {
 		if title == "" {
 			log.Fatalf("TODO: Title empty")
 		}
+		checkTitle(m.Notebook, title)
 
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print(fmt.Sprintf("Are you sure you want to delete %s (y/n): ", title))
@@ -136,21 +588,229 @@ func main() {
 		}
 
 		if text[0] == 'y' && text[1] == '\n' {
+			// The id is gone once the note is in the trash
+			label := noteLabel(&m, title)
 			err := m.Delete(title)
 			if err != nil {
 				log.Fatalf("Got error: '%v'", err)
 			}
-			fmt.Printf("Deleted %s\n", title)
+			fmt.Printf("Moved %s to the trash\n", title)
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, "delete: "+label)
 		} else {
 			fmt.Printf("Did not delete\n")
+			regenerateHTML(&m, r.NotesDir)
+		}
+	} else if r.Cmd == request.RENAME {
+		if r.RenameArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		if r.RenameArgs.NewTitle == "" {
+			log.Fatalf("Must provide the new title as the third argument")
+		}
+		if strings.Contains(r.RenameArgs.NewTitle, "_") {
+			log.Fatalf("Title may not contain any underscores")
+		}
+		checkTitle(m.Notebook, r.RenameArgs.Title)
+		checkTitle(m.Notebook, r.RenameArgs.NewTitle)
+
+		title, err := m.Rename(r.RenameArgs.Title, r.RenameArgs.NewTitle)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		fmt.Printf("Renamed %s to %s\n", r.RenameArgs.Title, title)
+		regenerateHTML(&m, r.NotesDir)
+		autoCommit(&m, r.NotesDir, fmt.Sprintf("rename: %s to %s", r.RenameArgs.Title, noteLabel(&m, title)))
+	} else if r.Cmd == request.LINKS {
+		if r.LinksArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		notes, err := m.ListNotes(nil)
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+		graph, err := m.LinkGraph(notes)
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+
+		// The graph is keyed by full name, the names printed are relative to
+		// the notebook like the names commands take
+		byName := make(map[string]manager.Note)
+		for _, note := range notes {
+			byName[note.FullName()] = note
+		}
+
+		// Without a title, report every broken link
+		title := r.LinksArgs.Title
+		broken := false
+		if title == "" {
+			manager.SortNotesById(notes)
+			for _, note := range notes {
+				for _, l := range graph.Outgoing[note.FullName()] {
+					if l.Name == "" {
+						fmt.Printf("%s:%d: broken link [[%s]]\n", m.NoteName(note), l.Line+1, l.Target)
+						broken = true
+					}
+				}
+			}
+		} else {
+			note, ok := manager.ResolveLink(notes, title)
+			if !ok {
+				log.Fatalf("No note called '%s'", title)
+			}
+			fmt.Printf("Links to:\n")
+			for _, l := range graph.Outgoing[note.FullName()] {
+				if l.Name == "" {
+					fmt.Printf("  %s (broken)\n", l.Target)
+					broken = true
+				} else {
+					fmt.Printf("  %s\n", m.NoteName(byName[l.Name]))
+				}
+			}
+			fmt.Printf("Linked from:\n")
+			for _, source := range graph.Incoming[note.FullName()] {
+				fmt.Printf("  %s\n", m.NoteName(byName[source]))
+			}
+		}
+		if broken {
+			os.Exit(1)
+		}
+	} else if r.Cmd == request.TRASH {
+		if r.TrashArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		if r.TrashArgs.Action == "list" {
+			trashed, err := m.ListTrash()
+			if err != nil {
+				log.Fatalf("TODO: Error '%v'", err)
+			}
+			for _, t := range trashed {
+				fmt.Printf("%s  %s\n", t.Deleted.Format("2006/01/02 15:04:05"), t.Title)
+			}
+		} else if r.TrashArgs.Action == "restore" {
+			if r.TrashArgs.Title == "" {
+				log.Fatalf("Must provide the title of the note to restore")
+			}
+			err := m.Restore(r.TrashArgs.Title)
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			fmt.Printf("Restored %s\n", r.TrashArgs.Title)
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, "trash restore: "+noteLabel(&m, r.TrashArgs.Title))
+		} else if r.TrashArgs.Action == "empty" {
+			// Only emptying the whole trash asks first, since --older-than
+			// already says which notes to delete
+			confirmed := r.TrashArgs.OlderThan != 0 || r.TrashArgs.Force
+			if !confirmed {
+				reader := bufio.NewReader(os.Stdin)
+				fmt.Print("Are you sure you want to permanently delete every note in the trash (y/n): ")
+				text, err := reader.ReadString('\n')
+				if err != nil {
+					log.Fatalf("TODO: Error %v", err)
+				}
+				confirmed = strings.TrimSpace(text) == "y"
+			}
+
+			if confirmed {
+				emptied, err := m.EmptyTrash(time.Duration(r.TrashArgs.OlderThan))
+				for _, t := range emptied {
+					fmt.Printf("Permanently deleted %s\n", t.Title)
+				}
+				if err != nil {
+					log.Fatalf("Got error: '%v'", err)
+				}
+			} else {
+				fmt.Printf("Did not empty the trash\n")
+			}
+		} else {
+			log.Fatalf("Must provide one of: [list restore empty]")
+		}
+	} else if r.Cmd == request.TODAY || r.Cmd == request.JOURNAL {
+		if r.JournalArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		if r.JournalArgs.Format == "" {
+			settings, err := m.LoadSettings()
+			if err != nil {
+				log.Fatalf("%v", err)
+			}
+			r.JournalArgs.Format = settings.JournalFormat
+		}
+		date := time.Now()
+		if r.JournalArgs.Date != "" {
+			var err error
+			date, err = time.ParseInLocation("2006-01-02", r.JournalArgs.Date, time.Local)
+			if err != nil {
+				log.Fatalf("Date must be of the form YYYY-MM-DD")
+			}
+		}
+
+		if r.JournalArgs.Week {
+			notes, err := m.JournalWeek(r.JournalArgs.Format, date)
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			if len(notes) == 0 {
+				fmt.Printf("No notes found\n")
+				os.Exit(1)
+			}
+			err = m.ViewAll(notes)
+			if err != nil {
+				log.Fatalf("TODO: Error '%v'", err)
+			}
+		} else {
+			err := m.OpenJournal(r.JournalArgs.Format, date)
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			regenerateHTML(&m, r.NotesDir)
+			title, err := manager.JournalTitle(r.JournalArgs.Format, date)
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			autoCommit(&m, r.NotesDir, "journal: "+noteLabel(&m, title))
+		}
+	} else if r.Cmd == request.SERVE {
+		if r.ServeArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		s := server.Server{Manager: &m, NotesDir: r.NotesDir, Options: htmlOptions(&m)}
+		fmt.Printf("Serving notes on %s\n", r.ServeArgs.Addr)
+		err := s.Serve(r.ServeArgs.Addr)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+	} else if r.Cmd == request.API {
+		if r.ServeArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		onChange := func() {
+			// The notes have already changed, so failing to write the html
+			// should not stop the api
+			err := writeAllHTML(&m, r.NotesDir)
+			if err != nil {
+				log.Printf("Could not regenerate the html: %v", err)
+			}
+		}
+		s := api.Server{Manager: &m, OnChange: onChange}
+		fmt.Printf("Serving the api on %s\n", r.ServeArgs.Addr)
+		err := s.Serve(r.ServeArgs.Addr)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
 		}
-		saveAsHTML(&m, []string{}, r.NotesDir, r.NotesDir+"/index.html")
 	} else if r.Cmd == request.CONCAT {
 		if r.ConcatArgs == nil {
 			log.Fatalf("TODO: error message, shouldn't get here")
 		}
 
-		notes, err := m.ListNotes(r.ConcatArgs.Tags)
+		notes, err := m.ListNotes(tagQuery(r.ConcatArgs.Tags))
 		if err != nil {
 			log.Fatalf("TODO: Error '%v'", err)
 		}
@@ -159,12 +819,113 @@ func main() {
 		if err != nil {
 			log.Fatalf("TODO: Error '%v'", err)
 		}
+	} else if r.Cmd == request.LIST {
+		if r.ListArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		format := r.ListArgs.Format
+		if format != "table" && format != "json" && format != "csv" && format != "paths" {
+			log.Fatalf("--format must be one of: [table json csv paths]")
+		}
+
+		listed, err := m.ListNotes(tagQuery(r.ListArgs.Tags))
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+		notes := []manager.Note{}
+		for _, note := range listed {
+			// Without a header the note has no id or tags to list
+			if note.HeaderError != "" {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %s\n", m.NoteName(note), note.HeaderError)
+				continue
+			}
+			notes = append(notes, note)
+		}
+		if r.ListArgs.Sort == "id" {
+			manager.SortNotesById(notes)
+		} else if r.ListArgs.Sort == "mtime" {
+			sort.SliceStable(notes, func(i, j int) bool {
+				return notes[i].ModTime.After(notes[j].ModTime)
+			})
+		} else if r.ListArgs.Sort == "title" {
+			sort.SliceStable(notes, func(i, j int) bool {
+				return strings.ToLower(m.NoteName(notes[i])) < strings.ToLower(m.NoteName(notes[j]))
+			})
+		} else {
+			log.Fatalf("--sort must be one of: [id mtime title]")
+		}
+		if len(notes) == 0 {
+			// Not on stdout, which may be piped to another program
+			fmt.Fprintf(os.Stderr, "No notes found\n")
+			os.Exit(1)
+		}
+
+		err = printNotes(&m, notes, format)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+	} else if r.Cmd == request.TAGS {
+		if r.TagsArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		var oldTags []string
+		var newTag string
+		if r.TagsArgs.Action == "" || r.TagsArgs.Action == "list" {
+			notes, err := m.ListNotes(nil)
+			if err != nil {
+				log.Fatalf("TODO: Error '%v'", err)
+			}
+			for _, t := range manager.CountTags(notes) {
+				fmt.Printf("%s (%d)\n", t.Tag, t.Count)
+			}
+			return
+		} else if r.TagsArgs.Action == "rename" {
+			if len(r.TagsArgs.Names) != 2 {
+				log.Fatalf("Must provide the tag to rename and its new name")
+			}
+			oldTags, newTag = r.TagsArgs.Names[:1], r.TagsArgs.Names[1]
+		} else if r.TagsArgs.Action == "merge" {
+			if len(r.TagsArgs.Names) == 0 || r.TagsArgs.Into == "" {
+				log.Fatalf("Must provide the tags to merge and the tag to merge them --into")
+			}
+			oldTags, newTag = r.TagsArgs.Names, r.TagsArgs.Into
+		} else {
+			log.Fatalf("Must provide one of: [list rename merge]")
+		}
+		if err := manager.ValidateTag(newTag); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		changes, err := m.RenameTags(oldTags, newTag, r.TagsArgs.DryRun)
+		for _, c := range changes {
+			if r.TagsArgs.DryRun {
+				printHeaderDiff(r.NotesDir, c)
+			} else {
+				fmt.Printf("Retagged %s\n", m.NoteName(c.Note))
+			}
+		}
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("No notes have the tags %v\n", oldTags)
+		} else if !r.TagsArgs.DryRun {
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, fmt.Sprintf(
+				"tags %s: %s to %s in %d notes",
+				r.TagsArgs.Action,
+				strings.Join(oldTags, ", "),
+				newTag,
+				len(changes),
+			))
+		}
 	} else if r.Cmd == request.FIND {
 		if r.FindArgs == nil {
 			log.Fatalf("TODO: error message, shouldn't get here")
 		}
 
-		notes, err := m.ListNotes(r.FindArgs.Tags)
+		notes, err := m.ListNotes(tagQuery(r.FindArgs.Tags))
 		if err != nil {
 			log.Fatalf("TODO: Error '%v'", err)
 		}
@@ -177,64 +938,222 @@ func main() {
 		if err != nil {
 			log.Fatalf("Got error: '%v'", err)
 		}
+	} else if r.Cmd == request.SEARCH {
+		if r.SearchArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		if r.SearchArgs.Query == "" {
+			log.Fatalf("Must provide a search query")
+		}
+
+		notes, err := m.ListNotes(tagQuery(r.SearchArgs.Tags))
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+		idx, err := m.BuildFullTextIndex(notes)
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+		results := idx.Search(manager.ParseSearchQuery(r.SearchArgs.Query))
+		if len(results) == 0 {
+			fmt.Printf("No notes found\n")
+			os.Exit(1)
+		}
+		for _, result := range results {
+			fmt.Printf("%s (%.2f)\n", m.NoteName(result.Note), result.Score)
+			for _, line := range result.Lines {
+				fmt.Printf("  %d: %s\n", line.Num+1, strings.TrimSpace(line.Text))
+			}
+		}
+	} else if r.Cmd == request.MIGRATE_HEADER {
+		if r.MigrateHeaderArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		var format manager.HeaderFormat
+		if r.MigrateHeaderArgs.To == "bracket" {
+			format = manager.BracketHeader
+		} else if r.MigrateHeaderArgs.To == "front-matter" {
+			format = manager.FrontMatterHeader
+		} else {
+			log.Fatalf("--to must be one of: [bracket front-matter]")
+		}
+
+		notes, err := m.ListNotes(tagQuery(r.MigrateHeaderArgs.Tags))
+		if err != nil {
+			log.Fatalf("TODO: Error '%v'", err)
+		}
+		failed := false
+		migrated := 0
+		for _, note := range notes {
+			changed, err := m.MigrateHeader(note, format, r.MigrateHeaderArgs.DryRun)
+			if err != nil {
+				fmt.Printf("Could not migrate %s: %v\n", m.NoteName(note), err)
+				failed = true
+			} else if changed {
+				fmt.Printf("Migrated %s\n", m.NoteName(note))
+				migrated += 1
+			}
+		}
+		if !r.MigrateHeaderArgs.DryRun {
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, fmt.Sprintf("migrate-header: %d notes to %s", migrated, r.MigrateHeaderArgs.To))
+		}
+		if failed {
+			os.Exit(1)
+		}
 	} else if r.Cmd == request.HTML {
 		if r.HtmlArgs == nil {
 			log.Fatalf("TODO: error message, shouldn't get here")
 		}
 
-		filepath := r.HtmlArgs.File
-		if filepath == "" {
-			filepath = r.NotesDir + "/index.html"
+		if r.HtmlArgs.Site != "" {
+			notes, err := m.ListNotes(tagQuery(r.HtmlArgs.Tags))
+			if err != nil {
+				log.Fatalf("TODO: Error '%v'", err)
+			}
+			err = html.GenerateSite(notes, r.NotesDir, r.HtmlArgs.Site, htmlOptions(&m))
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			return
+		}
+
+		// The html of only some notes must not replace the html of every
+		// note, which is regenerated by every other command
+		if r.HtmlArgs.File == "" && len(r.HtmlArgs.Tags) > 0 {
+			log.Fatalf("Must provide --file along with --tags")
+		}
+		if r.HtmlArgs.File == "" {
+			regenerateHTML(&m, r.NotesDir)
+			return
+		}
+		saveAsHTML(&m, tagQuery(r.HtmlArgs.Tags), r.NotesDir, r.HtmlArgs.File)
+	} else if r.Cmd == request.FSCK {
+		if r.FsckArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+
+		problems, err := m.Fsck(r.FsckArgs.DryRun)
+		fixed := 0
+		for _, p := range problems {
+			fmt.Println(p)
+			if p.NewId != -1 {
+				fixed += 1
+			}
+		}
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("No problems found\n")
+		} else if r.FsckArgs.DryRun {
+			os.Exit(1)
+		} else if fixed > 0 {
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, fmt.Sprintf("fsck: fixed %d ids", fixed))
 		}
-		saveAsHTML(&m, []string{}, r.NotesDir, filepath)
 	} else if r.Cmd == request.GIT {
-		cmd := exec.Command(
-			"bash",
-			"-c",
-			fmt.Sprintf("cd %s && git %s", r.NotesDir, strings.Join(r.Args, " ")),
-		)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Run()
+		err := gitRepo(r.NotesDir).Run(r.Args...)
+		exitOnGitError(err)
 	} else if r.Cmd == request.PUSH {
-		cmd := exec.Command(
-			"bash",
-			"-c",
-			fmt.Sprintf(
-				"cd %s && git add . && git commit -m \"%s\" && git push",
-				r.NotesDir,
-				time.Now().Format("2006.01.02 15:04:05"),
-			),
-		)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Run()
+		repo := gitRepo(r.NotesDir)
+		_, err := repo.CommitAll(commitMessage())
+		exitOnGitError(err)
+		err = repo.Run("push")
+		exitOnGitError(err)
+	} else if r.Cmd == request.HISTORY || r.Cmd == request.DIFF || r.Cmd == request.RESTORE {
+		if r.HistoryArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		title := r.HistoryArgs.Title
+		if title == "" {
+			log.Fatalf("Must provide a title")
+		}
+
+		repo := gitRepo(r.NotesDir)
+		file := m.NoteFileName(title)
+		history, err := repo.History(file)
+		exitOnGitError(err)
+		if len(history) == 0 {
+			fmt.Printf("No history found for %s\n", title)
+			os.Exit(1)
+		}
+
+		if r.Cmd == request.HISTORY {
+			for _, c := range history {
+				line := fmt.Sprintf("%s %s %s: %s", c.Hash[:7], c.Date.Format("2006/01/02 15:04"), c.Author, c.Subject)
+				if c.Path != file {
+					line += fmt.Sprintf(" (as %s)", c.Path)
+				}
+				fmt.Println(line)
+			}
+			return
+		}
+
+		rev := r.HistoryArgs.Rev
+		if rev == "" && r.Cmd == request.RESTORE {
+			log.Fatalf("Must provide the commit to restore from with --rev")
+		} else if rev == "" {
+			rev = "HEAD"
+		}
+		// The note may have had another name at rev
+		path, err := repo.PathAt(history, rev)
+		exitOnGitError(err)
+
+		if r.Cmd == request.DIFF {
+			// Only the two paths are compared, so any similarity between
+			// them is enough to show them as a rename
+			err = repo.Run("diff", "--find-renames=1%", rev, "--", path, file)
+			exitOnGitError(err)
+		} else {
+			content, err := repo.Output("show", rev+":./"+path)
+			exitOnGitError(err)
+			err = ioutil.WriteFile(r.NotesDir+"/"+file, []byte(content), 0644)
+			if err != nil {
+				log.Fatalf("Got error: '%v'", err)
+			}
+			fmt.Printf("Restored %s from %s\n", title, rev)
+			regenerateHTML(&m, r.NotesDir)
+			autoCommit(&m, r.NotesDir, fmt.Sprintf("restore: %s from %s", noteLabel(&m, title), rev), file)
+		}
+	} else if r.Cmd == request.SYNC {
+		if r.SyncArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		repo := gitRepo(r.NotesDir)
+		// Only report what sync did, rather than everything git prints
+		repo.Stdout = nil
+		err := syncNotes(&m, repo, r.NotesDir, r.SyncArgs.Merge)
+		if _, ok := err.(*vcs.Error); ok {
+			exitOnGitError(err)
+		} else if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
+		}
 	} else if r.Cmd == request.INIT_REPO {
-		if len(r.Args) == 0 {
+		if r.InitRepoArgs == nil {
+			log.Fatalf("TODO: error message, shouldn't get here")
+		}
+		if r.InitRepoArgs.Origin == "" {
 			log.Fatalf("Must provide origin as first argument")
 		}
-		cmd := exec.Command(
-			"bash",
-			"-c",
-			fmt.Sprintf(`
-cd %s &&
-git init &&
-git remote add origin %s &&
-echo "%s" >> README.txt &&
-git add . &&
-git commit -m "Init repo" &&
-git push -u origin master
-`,
-				r.NotesDir,
-				r.Args[0],
-				readmeString,
-			),
-		)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Run()
+
+		repo := gitRepo(r.NotesDir)
+		err := repo.Init(r.InitRepoArgs.Origin)
+		exitOnGitError(err)
+		readme, err := os.OpenFile(r.NotesDir+"/README.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		_, err = readme.WriteString(readmeString + "\n")
+		readme.Close()
+		if err != nil {
+			log.Fatalf("Got error: '%v'", err)
+		}
+		_, err = repo.CommitAll("Init repo")
+		exitOnGitError(err)
+		err = repo.Run("push", "-u", "origin", "HEAD")
+		exitOnGitError(err)
 	}
 }
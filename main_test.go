@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/jbrunsting/note-taker/manager"
+	"github.com/jbrunsting/note-taker/vcs"
+)
+
+// An editor that resolves a conflict by replacing the file with 'resolved'
+var resolvingEditor = []string{"sh", "-c", `printf 'resolved\n' > "$1"`, "sh"}
+
+func mustRun(t *testing.T, r *vcs.Repo, args ...string) {
+	t.Helper()
+	if err := r.Run(args...); err != nil {
+		t.Fatalf("git %v: %v", args, err)
+	}
+}
+
+// newClones creates a bare repository with an initial commit and two clones
+// of it, returning the notes directories of the clones, which are notesDir
+// below the root of each clone
+func newClones(t *testing.T, notesDir string) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	bare := filepath.Join(dir, "origin.git")
+	mustRun(t, &vcs.Repo{Dir: dir}, "init", "-q", "--bare", "origin.git")
+	mustRun(t, &vcs.Repo{Dir: bare}, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	clones := []string{}
+	for i, name := range []string{"a", "b"} {
+		mustRun(t, &vcs.Repo{Dir: dir}, "clone", "-q", bare, name)
+		r := &vcs.Repo{Dir: filepath.Join(dir, name)}
+		for _, args := range [][]string{
+			{"config", "user.name", "Test"},
+			{"config", "user.email", "test@example.com"},
+			{"config", "commit.gpgsign", "false"},
+		} {
+			mustRun(t, r, args...)
+		}
+		if i == 0 {
+			mustRun(t, r, "checkout", "-q", "-b", "main")
+			writeNote(t, filepath.Join(r.Dir, notesDir), "Shared.md", "base\n")
+			mustRun(t, r, "add", "--all")
+			mustRun(t, r, "commit", "-q", "-m", "base")
+			mustRun(t, r, "push", "-q", "-u", "origin", "main")
+		} else {
+			mustRun(t, r, "pull", "-q")
+		}
+		clones = append(clones, filepath.Join(r.Dir, notesDir))
+	}
+	return clones[0], clones[1]
+}
+
+func writeNote(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readNote(t *testing.T, dir string, name string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func sync(t *testing.T, notesDir string, merge bool) {
+	t.Helper()
+	m := &manager.Manager{Dir: notesDir, Editor: resolvingEditor}
+	if err := syncNotes(m, &vcs.Repo{Dir: notesDir}, notesDir, merge); err != nil {
+		t.Fatalf("syncNotes in %s: %v", notesDir, err)
+	}
+}
+
+func TestSyncNotes(t *testing.T) {
+	a, b := newClones(t, "")
+
+	writeNote(t, a, "New.md", "new\n")
+	sync(t, a, false)
+	sync(t, b, false)
+	if readNote(t, b, "New.md") != "new\n" {
+		t.Errorf("The note created in one clone was not synced to the other")
+	}
+
+	// Nothing is left to commit, pull or push
+	sync(t, b, false)
+	out, err := (&vcs.Repo{Dir: b}).Output("status", "--porcelain")
+	if err != nil || out != "" {
+		t.Errorf("The clone has changes after syncing: %q, %v", out, err)
+	}
+}
+
+func TestSyncNotesResolvesConflicts(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		notesDir string
+		merge    bool
+	}{
+		{"rebase", "", false},
+		{"merge", "", true},
+		// The conflicting paths must be found relative to the notes
+		// directory rather than the root of the repository
+		{"rebase in subdirectory", "notes", false},
+		{"merge in subdirectory", "notes", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, b := newClones(t, test.notesDir)
+
+			writeNote(t, a, "Shared.md", "from a\n")
+			sync(t, a, test.merge)
+			writeNote(t, b, "Shared.md", "from b\n")
+			sync(t, b, test.merge)
+			sync(t, a, test.merge)
+
+			for _, dir := range []string{a, b} {
+				if content := readNote(t, dir, "Shared.md"); content != "resolved\n" {
+					t.Errorf("Shared.md in %s is %q after syncing", dir, content)
+				}
+			}
+		})
+	}
+}
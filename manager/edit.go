@@ -7,37 +7,48 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 )
 
 const (
 	DefaultEditor = "vim"
 	MaxDuplicates = 10000
+	// Notes refer to files in the notes directory with this prefix
+	NotesDirKey = "$NOTES"
 )
 
 func (m *Manager) getPath(name string) string {
 	return fmt.Sprintf("%s/%s", m.Dir, name)
 }
 
+// getFileName returns the path relative to Dir of the file for name in the
+// notebook of the manager
 func (m *Manager) getFileName(name string, extension string, duplicates int) string {
+	name = m.inNotebook(name)
 	if duplicates == 0 {
 		return fmt.Sprintf("%s.%s", name, extension)
 	}
 	return fmt.Sprintf("%s(%d).%s", name, duplicates+1, extension)
 }
 
-func edit(path string) error {
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = DefaultEditor
+// EditFile opens the file at path in the editor of the manager, or $EDITOR,
+// or vim if neither is set
+func (m *Manager) EditFile(path string) error {
+	editor := m.Editor
+	if len(editor) == 0 {
+		editor = strings.Fields(os.Getenv("EDITOR"))
+	}
+	if len(editor) == 0 {
+		editor = []string{DefaultEditor}
 	}
 
-	executable, err := exec.LookPath(editor)
+	executable, err := exec.LookPath(editor[0])
 	if err != nil {
 		return err
 	}
 
-	cmd := exec.Command(executable, path)
+	cmd := exec.Command(executable, append(editor[1:], path)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -45,83 +56,151 @@ func edit(path string) error {
 	return cmd.Run()
 }
 
+// NoteFileName returns the name of the file of the note called name, relative
+// to the notes directory
+func (m *Manager) NoteFileName(name string) string {
+	return m.getFileName(name, "md", 0)
+}
+
 func (m *Manager) Edit(name string) error {
 	path := m.getPath(m.getFileName(name, "md", 0))
 	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-	return edit(m.getPath(m.getFileName(name, "md", 0)))
+	m.markChanged(m.getFileName(name, "md", 0))
+	return m.EditFile(path)
 }
 
-func (m *Manager) Move(src string, name string, extension string) error {
+// freeFileName returns the first file name for name that is not taken,
+// adding a (2), (3), ... suffix when there are conflicts
+func (m *Manager) freeFileName(name string, extension string) (string, error) {
 	duplicates := 0
-
-	var path string
-	var err error
 	for {
-		path = m.getPath(m.getFileName(name, extension, duplicates))
-		_, err = os.Stat(path)
-		if err != nil {
-			break
+		fileName := m.getFileName(name, extension, duplicates)
+		_, err := os.Stat(m.getPath(fileName))
+		if os.IsNotExist(err) {
+			return fileName, nil
+		} else if err != nil {
+			return "", err
 		}
 
 		duplicates += 1
-		if duplicates > 10000 {
-			return fmt.Errorf("All file names had conflicts")
+		if duplicates > MaxDuplicates {
+			return "", fmt.Errorf("All file names had conflicts")
 		}
 	}
-	if !os.IsNotExist(err) {
+}
+
+func (m *Manager) Move(src string, name string, extension string) error {
+	fileName, err := m.freeFileName(name, extension)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(m.getPath(fileName)), os.ModePerm)
+	if err != nil {
 		return err
 	}
+	m.markChanged(fileName)
+	return os.Rename(src, m.getPath(fileName))
+}
+
+// create writes a new note, creating its notebook if needed, and returns the
+// file name of the note
+func (m *Manager) create(name string, content string) (string, error) {
+	fileName, err := m.freeFileName(name, "md")
+	if err != nil {
+		return "", err
+	}
+	path := m.getPath(fileName)
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	m.markChanged(fileName)
+	_, err = file.WriteString(content)
+	if err != nil {
+		return "", err
+	}
 
-	return os.Rename(src, path)
+	return fileName, nil
 }
 
-func (m *Manager) CreateAndEdit(name string, header string) error {
-	duplicates := 0
+// Create allocates the next free id and creates a note with the content
+// returned by content for that id, returning the name of the new note, which
+// has a (2), (3), ... suffix if the name was taken
+func (m *Manager) Create(name string, content func(id int) (string, error)) (string, error) {
+	fileName, err := m.createWithId(name, content)
+	if err != nil {
+		return "", err
+	}
+	return m.fromNotebook(strings.TrimSuffix(fileName, ".md")), nil
+}
 
-	var path string
-	var err error
-	for {
-		path = m.getPath(m.getFileName(name, "md", duplicates))
-		_, err = os.Stat(path)
-		if err != nil {
-			break
-		}
+func (m *Manager) createWithId(name string, content func(id int) (string, error)) (string, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
 
-		duplicates += 1
-		if duplicates > 10000 {
-			return fmt.Errorf("All file names had conflicts")
-		}
+	id, err := m.NextId()
+	if err != nil {
+		return "", err
 	}
-	if !os.IsNotExist(err) {
-		return err
+	c, err := content(id)
+	if err != nil {
+		return "", err
 	}
+	return m.create(name, c)
+}
 
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+// CreateAndEdit creates a note as Create does and opens it in the editor
+func (m *Manager) CreateAndEdit(name string, content func(id int) (string, error)) error {
+	// The lock is released before editing so other notes can be created
+	// while this one is open
+	fileName, err := m.createWithId(name, content)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = file.WriteString(header)
+	return m.EditFile(m.getPath(fileName))
+}
+
+// WriteNote replaces the content of the existing note called name
+func (m *Manager) WriteNote(name string, content string) error {
+	path := m.getPath(m.getFileName(name, "md", 0))
+	_, err := os.Stat(path)
 	if err != nil {
 		return err
 	}
-
-	return edit(path)
+	m.markChangedPath(path)
+	return ioutil.WriteFile(path, []byte(content), 0644)
 }
 
+// ReadNote returns the lines of the note, notes that have not changed since
+// they were last read are returned from memory
 func (m *Manager) ReadNote(note *Note) ([]string, error) {
+	if cached, ok := m.contents[note.Path]; ok && note.Hash != "" && cached.Hash == note.Hash {
+		return cached.Lines, nil
+	}
+
 	content, err := ioutil.ReadFile(note.Path)
 	if err != nil {
 		return []string{}, err
 	}
-	return strings.Split(string(content), "\n"), nil
-}
+	lines := strings.Split(string(content), "\n")
 
-func (m *Manager) Delete(name string) error {
-	return os.Remove(m.getPath(m.getFileName(name, "md", 0)))
+	if m.contents == nil {
+		m.contents = make(map[string]cachedContent)
+	}
+	m.contents[note.Path] = cachedContent{hashContent(content), lines}
+	return lines, nil
 }
 
 func (m *Manager) ViewAll(notes []Note) error {
@@ -174,5 +253,5 @@ func (m *Manager) ViewAll(notes []Note) error {
 		}
 	}
 
-	return edit(path)
+	return m.EditFile(path)
 }
@@ -0,0 +1,309 @@
+package manager
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxResultLines  = 20
+	titleLineNumber = -1
+)
+
+type token struct {
+	Term  string
+	Line  int
+	Start int
+	End   int
+}
+
+// tokenize splits a line into lowercase words, keeping the byte offsets of
+// each word so that matches can be highlighted
+func tokenize(text string, line int) []token {
+	tokens := []token{}
+	start := -1
+	for i, c := range text {
+		isWord := unicode.IsLetter(c) || unicode.IsDigit(c)
+		if isWord && start == -1 {
+			start = i
+		} else if !isWord && start != -1 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), line, start, i})
+			start = -1
+		}
+	}
+	if start != -1 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), line, start, len(text)})
+	}
+	return tokens
+}
+
+type document struct {
+	Note   Note
+	Lines  []string
+	Tokens []token
+}
+
+// FullTextIndex is an inverted index from each word to the positions it occurs
+// at in every note
+type FullTextIndex struct {
+	docs  []document
+	terms map[string]map[int][]int
+	// All indexed terms in sorted order, used to expand prefix queries
+	sortedTerms []string
+	avgLength   float64
+	weights     SearchWeights
+}
+
+func (m *Manager) BuildFullTextIndex(notes []Note) (*FullTextIndex, error) {
+	idx := &FullTextIndex{terms: make(map[string]map[int][]int), weights: m.searchWeights()}
+	totalLength := 0
+	for _, note := range notes {
+		lines, err := m.ReadNote(&note)
+		if err != nil {
+			return nil, err
+		}
+
+		doc := document{note, lines, tokenize(note.Title, titleLineNumber)}
+		for i, line := range lines {
+			doc.Tokens = append(doc.Tokens, tokenize(line, i)...)
+		}
+
+		docId := len(idx.docs)
+		for pos, t := range doc.Tokens {
+			postings, ok := idx.terms[t.Term]
+			if !ok {
+				postings = make(map[int][]int)
+				idx.terms[t.Term] = postings
+				idx.sortedTerms = append(idx.sortedTerms, t.Term)
+			}
+			postings[docId] = append(postings[docId], pos)
+		}
+		totalLength += len(doc.Tokens)
+		idx.docs = append(idx.docs, doc)
+	}
+
+	sort.Strings(idx.sortedTerms)
+	if len(idx.docs) > 0 {
+		idx.avgLength = float64(totalLength) / float64(len(idx.docs))
+	}
+	return idx, nil
+}
+
+// A clause is either a single word or a quoted phrase. The last word of a
+// clause may end in '*', which matches any word starting with it.
+type clause struct {
+	Words  []string
+	Prefix bool
+}
+
+type SearchQuery []clause
+
+// ParseSearchQuery splits a query into words and "quoted phrases", every
+// clause of the query must match for a note to be returned
+func ParseSearchQuery(query string) SearchQuery {
+	q := SearchQuery{}
+	addClause := func(text string) {
+		prefix := strings.HasSuffix(strings.TrimSpace(text), "*")
+		words := []string{}
+		for _, t := range tokenize(text, 0) {
+			words = append(words, t.Term)
+		}
+		if len(words) > 0 {
+			q = append(q, clause{words, prefix})
+		}
+	}
+
+	for i, part := range strings.Split(query, "\"") {
+		if i%2 == 1 {
+			addClause(part)
+		} else {
+			for _, word := range strings.Fields(part) {
+				addClause(word)
+			}
+		}
+	}
+	return q
+}
+
+// WithPrefix makes the last word of the query match as a prefix, which is
+// what is wanted when searching as the query is typed
+func (q SearchQuery) WithPrefix() SearchQuery {
+	if len(q) == 0 {
+		return q
+	}
+	out := append(SearchQuery{}, q...)
+	out[len(out)-1].Prefix = true
+	return out
+}
+
+type MatchLine struct {
+	Num  int
+	Text string
+	// Byte ranges of the words in Text that matched the query
+	Spans [][2]int
+}
+
+type SearchResult struct {
+	Note  Note
+	Score float64
+	Lines []MatchLine
+}
+
+func (idx *FullTextIndex) expand(word string, prefix bool) []string {
+	if !prefix {
+		if _, ok := idx.terms[word]; ok {
+			return []string{word}
+		}
+		return []string{}
+	}
+	terms := []string{}
+	for i := sort.SearchStrings(idx.sortedTerms, word); i < len(idx.sortedTerms); i++ {
+		if !strings.HasPrefix(idx.sortedTerms[i], word) {
+			break
+		}
+		terms = append(terms, idx.sortedTerms[i])
+	}
+	return terms
+}
+
+// matchClause returns, for every document that contains the clause, the token
+// positions where the clause starts
+func (idx *FullTextIndex) matchClause(c clause) map[int][]int {
+	starts := make(map[int][]int)
+	last := len(c.Words) - 1
+	for _, term := range idx.expand(c.Words[0], c.Prefix && last == 0) {
+		for docId, positions := range idx.terms[term] {
+			starts[docId] = append(starts[docId], positions...)
+		}
+	}
+
+	for i := 1; i <= last && len(starts) > 0; i++ {
+		next := make(map[[2]int]bool)
+		nextDocs := make(map[int]bool)
+		for _, term := range idx.expand(c.Words[i], c.Prefix && i == last) {
+			for docId, positions := range idx.terms[term] {
+				for _, pos := range positions {
+					next[[2]int{docId, pos}] = true
+					nextDocs[docId] = true
+				}
+			}
+		}
+
+		for docId, positions := range starts {
+			if !nextDocs[docId] {
+				delete(starts, docId)
+				continue
+			}
+			kept := []int{}
+			for _, pos := range positions {
+				if next[[2]int{docId, pos + i}] {
+					kept = append(kept, pos)
+				}
+			}
+			if len(kept) == 0 {
+				delete(starts, docId)
+			} else {
+				starts[docId] = kept
+			}
+		}
+	}
+	return starts
+}
+
+func (idx *FullTextIndex) bm25(tf float64, df int, length int) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+	k1, b := idx.weights.BM25K1, idx.weights.BM25B
+	norm := 1 - b + b*float64(length)/idx.avgLength
+	return idf * tf * (k1 + 1) / (tf + k1*norm)
+}
+
+// Search returns the notes matching every clause of the query, ranked by
+// their BM25 score with matches in the title weighted more heavily
+func (idx *FullTextIndex) Search(q SearchQuery) []SearchResult {
+	if len(q) == 0 {
+		return []SearchResult{}
+	}
+
+	scores := make(map[int]float64)
+	matched := make(map[int]map[int]bool)
+	for i, c := range q {
+		starts := idx.matchClause(c)
+		for docId := range scores {
+			if _, ok := starts[docId]; !ok {
+				delete(scores, docId)
+			}
+		}
+
+		for docId, positions := range starts {
+			if _, ok := scores[docId]; !ok && i != 0 {
+				continue
+			}
+			doc := idx.docs[docId]
+			tf := 0.0
+			for _, pos := range positions {
+				if doc.Tokens[pos].Line == titleLineNumber {
+					tf += idx.weights.TitleBoost
+				} else {
+					tf += 1
+				}
+				if matched[docId] == nil {
+					matched[docId] = make(map[int]bool)
+				}
+				for j := range c.Words {
+					matched[docId][pos+j] = true
+				}
+			}
+			scores[docId] += idx.bm25(tf, len(starts), len(doc.Tokens))
+		}
+	}
+
+	results := []SearchResult{}
+	for docId, score := range scores {
+		results = append(results, SearchResult{
+			Note:  idx.docs[docId].Note,
+			Score: score,
+			Lines: idx.matchLines(docId, matched[docId]),
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].Note.Title < results[j].Note.Title
+		}
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+func (idx *FullTextIndex) matchLines(docId int, matched map[int]bool) []MatchLine {
+	doc := idx.docs[docId]
+	lines := []MatchLine{}
+	for pos, t := range doc.Tokens {
+		if !matched[pos] || t.Line == titleLineNumber {
+			continue
+		}
+		if len(lines) == 0 || lines[len(lines)-1].Num != t.Line {
+			if len(lines) >= maxResultLines {
+				break
+			}
+			lines = append(lines, MatchLine{t.Line, doc.Lines[t.Line], [][2]int{}})
+		}
+		l := &lines[len(lines)-1]
+		l.Spans = append(l.Spans, [2]int{t.Start, t.End})
+	}
+	return lines
+}
+
+// Highlight splits text into alternating unmatched and matched parts, the
+// first part is never a match and may be empty
+func (l MatchLine) Highlight() []string {
+	parts := []string{}
+	prev := 0
+	for _, span := range l.Spans {
+		parts = append(parts, l.Text[prev:span[0]], l.Text[span[0]:span[1]])
+		prev = span[1]
+	}
+	return append(parts, l.Text[prev:])
+}
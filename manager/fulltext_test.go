@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// searchNotes writes the notes, named by their titles, and returns the titles
+// of the notes matching the query in the order they are ranked
+func searchNotes(t *testing.T, notes map[string]string, query string) ([]string, []SearchResult) {
+	t.Helper()
+	m := newTestManager(t)
+	for title, content := range notes {
+		writeNote(t, m, title+".md", content)
+	}
+	listed, err := m.ListNotes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := m.BuildFullTextIndex(listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := idx.Search(ParseSearchQuery(query))
+	titles := []string{}
+	for _, r := range results {
+		titles = append(titles, r.Note.Title)
+	}
+	return titles, results
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  SearchQuery
+	}{
+		{"", SearchQuery{}},
+		{"Red apple", SearchQuery{{[]string{"red"}, false}, {[]string{"apple"}, false}}},
+		{`"red apple" pie`, SearchQuery{{[]string{"red", "apple"}, false}, {[]string{"pie"}, false}}},
+		{"app*", SearchQuery{{[]string{"app"}, true}}},
+		{`"red app*"`, SearchQuery{{[]string{"red", "app"}, true}}},
+		// Punctuation splits words, and a clause of only punctuation is dropped
+		{"k8s-prod ...", SearchQuery{{[]string{"k8s", "prod"}, false}}},
+	} {
+		if got := ParseSearchQuery(test.query); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseSearchQuery(%q) = %v, want %v", test.query, got, test.want)
+		}
+	}
+
+	q := ParseSearchQuery("red app").WithPrefix()
+	if q[0].Prefix || !q[1].Prefix {
+		t.Errorf("WithPrefix should only make the last clause a prefix, got %v", q)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	notes := map[string]string{
+		"Once":  "We moved the build to kubernetes last week, along with the rest of the services we run\n",
+		"Often": "kubernetes kubernetes\nkubernetes upgrade\n",
+		"None":  "Nothing about clusters here\n",
+	}
+	titles, _ := searchNotes(t, notes, "kubernetes")
+	if !reflect.DeepEqual(titles, []string{"Often", "Once"}) {
+		t.Errorf("A note mentioning the term more often should rank first, got %v", titles)
+	}
+
+	// Every word of the query must match
+	titles, _ = searchNotes(t, notes, "kubernetes upgrade")
+	if !reflect.DeepEqual(titles, []string{"Often"}) {
+		t.Errorf("Searching for two words returned %v", titles)
+	}
+
+	// A match in the title counts for more than one in the body of a note of
+	// the same length
+	titles, _ = searchNotes(t, map[string]string{
+		"Kubernetes": "notes about clusters\n",
+		"Clusters":   "notes about kubernetes\n",
+	}, "kubernetes")
+	if !reflect.DeepEqual(titles, []string{"Kubernetes", "Clusters"}) {
+		t.Errorf("A match in the title should rank first, got %v", titles)
+	}
+
+	// Rare words count for more than common ones
+	titles, _ = searchNotes(t, map[string]string{
+		"A": "common common rare\n",
+		"B": "common rare rare\n",
+		"C": "common\n",
+		"D": "common\n",
+	}, "common rare")
+	if !reflect.DeepEqual(titles, []string{"B", "A"}) {
+		t.Errorf("The note with the rarer word more often should rank first, got %v", titles)
+	}
+}
+
+func TestSearchPhrases(t *testing.T) {
+	notes := map[string]string{
+		"Adjacent": "a red apple\n",
+		"Apart":    "red and apple\n",
+		"Reversed": "apple red\n",
+	}
+	titles, _ := searchNotes(t, notes, `"red apple"`)
+	if !reflect.DeepEqual(titles, []string{"Adjacent"}) {
+		t.Errorf("A phrase should only match adjacent words in order, got %v", titles)
+	}
+	titles, _ = searchNotes(t, notes, "red apple")
+	if len(titles) != 3 {
+		t.Errorf("Unquoted words should match anywhere in the note, got %v", titles)
+	}
+}
+
+func TestSearchPrefix(t *testing.T) {
+	notes := map[string]string{
+		"Kubectl":    "run kubectl apply\n",
+		"Kubernetes": "the kubernetes cluster\n",
+		"Kube":       "a kub\n",
+		"Cube":       "a cube\n",
+	}
+	titles, _ := searchNotes(t, notes, "kube")
+	if len(titles) != 1 || titles[0] != "Kube" {
+		t.Errorf("Without '*' only whole words should match, got %v", titles)
+	}
+	titles, _ = searchNotes(t, notes, "kube*")
+	sort.Strings(titles)
+	if !reflect.DeepEqual(titles, []string{"Kube", "Kubectl", "Kubernetes"}) {
+		t.Errorf("'kube*' returned %v", titles)
+	}
+	titles, _ = searchNotes(t, notes, `"the kube*"`)
+	if !reflect.DeepEqual(titles, []string{"Kubernetes"}) {
+		t.Errorf("A phrase ending in '*' returned %v", titles)
+	}
+	titles, _ = searchNotes(t, notes, "zzz*")
+	if len(titles) != 0 {
+		t.Errorf("A prefix of no word returned %v", titles)
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	_, results := searchNotes(t, map[string]string{
+		"Fruit": "intro\nA red apple, and a Red pear\nnothing\nred apple again\n",
+	}, "red")
+	if len(results) != 1 {
+		t.Fatalf("Search returned %v", results)
+	}
+	lines := results[0].Lines
+	want := []MatchLine{
+		{1, "A red apple, and a Red pear", [][2]int{{2, 5}, {19, 22}}},
+		{3, "red apple again", [][2]int{{0, 3}}},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("The matching lines are %v, want %v", lines, want)
+	}
+
+	parts := lines[0].Highlight()
+	if !reflect.DeepEqual(parts, []string{"A ", "red", " apple, and a ", "Red", " pear"}) {
+		t.Errorf("Highlight returned %q", parts)
+	}
+	parts = lines[1].Highlight()
+	if !reflect.DeepEqual(parts, []string{"", "red", " apple again"}) {
+		t.Errorf("Highlight returned %q", parts)
+	}
+	parts = MatchLine{0, "no match", [][2]int{}}.Highlight()
+	if !reflect.DeepEqual(parts, []string{"no match"}) {
+		t.Errorf("Highlight returned %q", parts)
+	}
+}
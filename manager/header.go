@@ -0,0 +1,310 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type HeaderFormat int
+
+const (
+	NoHeader HeaderFormat = iota
+	BracketHeader
+	FrontMatterHeader
+)
+
+const (
+	frontMatterDelimiter = "---"
+	dateFormat           = "2006-01-02"
+)
+
+// Metadata holds the fields that can only be stored in a front matter header,
+// Fields holds any keys that are not otherwise recognized
+type Metadata struct {
+	Created time.Time
+	Aliases []string
+	Status  string
+	Source  string
+	Fields  map[string]interface{}
+}
+
+func (m Metadata) IsEmpty() bool {
+	return m.Created.IsZero() && len(m.Aliases) == 0 && m.Status == "" && m.Source == "" && len(m.Fields) == 0
+}
+
+type Header struct {
+	Format HeaderFormat
+	Id     int
+	Tags   []string
+	Meta   Metadata
+	// Items in a bracket header that are neither an id nor a tag
+	Extra []string
+}
+
+// stringList is a yaml list of strings that can also be written as a single
+// string, such as 'tags: work'
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+type frontMatter struct {
+	Id      *int                   `yaml:"id,omitempty"`
+	Tags    stringList             `yaml:"tags,omitempty"`
+	Created string                 `yaml:"created,omitempty"`
+	Aliases stringList             `yaml:"aliases,omitempty"`
+	Status  string                 `yaml:"status,omitempty"`
+	Source  string                 `yaml:"source,omitempty"`
+	Fields  map[string]interface{} `yaml:",inline"`
+}
+
+// normalizeYaml converts the map[interface{}]interface{} values produced by the
+// yaml package into map[string]interface{} so they can be stored as JSON
+func normalizeYaml(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{})
+		for k, val := range v {
+			out[fmt.Sprint(k)] = normalizeYaml(val)
+		}
+		return out
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYaml(val)
+		}
+	}
+	return v
+}
+
+func parseBracketHeader(line string) (Header, bool) {
+	h := Header{Format: BracketHeader, Id: -1, Tags: []string{}}
+	line = strings.TrimSpace(line)
+	if len(line) < 2 || line[0] != '[' || line[len(line)-1] != ']' {
+		return h, false
+	}
+	listItems := strings.Split(line[1:len(line)-1], ",")
+	for _, item := range listItems {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			if item[0] == '#' {
+				h.Tags = append(h.Tags, item[1:])
+			} else if item[0] == '@' {
+				nid, err := strconv.Atoi(item[1:])
+				if err == nil {
+					h.Id = nid
+				} else {
+					h.Extra = append(h.Extra, item)
+				}
+			} else {
+				h.Extra = append(h.Extra, item)
+			}
+		}
+	}
+	return h, true
+}
+
+// parseFrontMatter returns false if content does not start with a front
+// matter block. A block that is not valid YAML is still a front matter header,
+// it is returned with an error and without an id or tags.
+func parseFrontMatter(content string) (Header, string, bool, error) {
+	h := Header{Format: FrontMatterHeader, Id: -1, Tags: []string{}}
+	lines := strings.SplitAfter(content, "\n")
+	if strings.TrimSpace(lines[0]) != frontMatterDelimiter {
+		return h, content, false, nil
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == frontMatterDelimiter {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return h, content, false, nil
+	}
+	body := strings.Join(lines[end+1:], "")
+
+	var fm frontMatter
+	err := yaml.Unmarshal([]byte(strings.Join(lines[1:end], "")), &fm)
+	if err != nil {
+		return h, body, true, fmt.Errorf("Invalid front matter: %v", err)
+	}
+
+	if fm.Id != nil {
+		h.Id = *fm.Id
+	}
+	if fm.Tags != nil {
+		h.Tags = []string(fm.Tags)
+	}
+	h.Meta.Aliases = []string(fm.Aliases)
+	h.Meta.Status = fm.Status
+	h.Meta.Source = fm.Source
+	if len(fm.Fields) > 0 {
+		h.Meta.Fields = normalizeYaml(fm.Fields).(map[string]interface{})
+	}
+	if fm.Created != "" {
+		created, err := time.Parse(dateFormat, fm.Created)
+		if err != nil {
+			created, err = time.Parse(time.RFC3339, fm.Created)
+		}
+		if err == nil {
+			h.Meta.Created = created
+		} else {
+			// Kept as it was written rather than losing the header over
+			// a date in another layout, such as 2026-10-17 09:30
+			if h.Meta.Fields == nil {
+				h.Meta.Fields = make(map[string]interface{})
+			}
+			h.Meta.Fields["created"] = fm.Created
+		}
+	}
+
+	return h, body, true, nil
+}
+
+// parseHeader reads either a '[@id, #tag]' first line or a YAML front matter
+// block from the start of a note, returning the header and the rest of the
+// note. Notes without a header have the NoHeader format and an id of -1. A
+// front matter block that cannot be parsed is returned as a header without an
+// id or tags along with the error, so that it is never mistaken for a note
+// without a header.
+func parseHeader(content string) (Header, string, error) {
+	if h, body, ok, err := parseFrontMatter(content); ok {
+		return h, body, err
+	}
+
+	lines := strings.SplitN(content, "\n", 2)
+	if h, ok := parseBracketHeader(lines[0]); ok {
+		if len(lines) > 1 {
+			return h, lines[1], nil
+		}
+		return h, "", nil
+	}
+	return Header{Format: NoHeader, Id: -1, Tags: []string{}}, content, nil
+}
+
+// StripHeader removes the header of either form from the content of a note
+func StripHeader(content string) string {
+	_, body, _ := parseHeader(content)
+	return body
+}
+
+func (h Header) bracketString() (string, error) {
+	if !h.Meta.IsEmpty() {
+		return "", fmt.Errorf("A [@id, #tag] header cannot hold created, aliases, status, source or custom fields")
+	}
+	items := []string{}
+	if h.Id != -1 {
+		items = append(items, "@"+strconv.Itoa(h.Id))
+	}
+	for _, tag := range h.Tags {
+		items = append(items, "#"+tag)
+	}
+	items = append(items, h.Extra...)
+	return "[" + strings.Join(items, ", ") + "]\n", nil
+}
+
+func (h Header) frontMatterString() (string, error) {
+	if len(h.Extra) != 0 {
+		return "", fmt.Errorf("A front matter header cannot hold the header items '%s'", strings.Join(h.Extra, ", "))
+	}
+
+	// Custom fields are written after the known ones, in sorted order
+	fm := yaml.MapSlice{}
+	if h.Id != -1 {
+		fm = append(fm, yaml.MapItem{Key: "id", Value: h.Id})
+	}
+	if len(h.Tags) != 0 {
+		fm = append(fm, yaml.MapItem{Key: "tags", Value: h.Tags})
+	}
+	if !h.Meta.Created.IsZero() {
+		created := h.Meta.Created.Format(time.RFC3339)
+		if h.Meta.Created.Equal(h.Meta.Created.Truncate(24 * time.Hour)) {
+			created = h.Meta.Created.Format(dateFormat)
+		}
+		fm = append(fm, yaml.MapItem{Key: "created", Value: created})
+	}
+	if len(h.Meta.Aliases) != 0 {
+		fm = append(fm, yaml.MapItem{Key: "aliases", Value: h.Meta.Aliases})
+	}
+	if h.Meta.Status != "" {
+		fm = append(fm, yaml.MapItem{Key: "status", Value: h.Meta.Status})
+	}
+	if h.Meta.Source != "" {
+		fm = append(fm, yaml.MapItem{Key: "source", Value: h.Meta.Source})
+	}
+	keys := []string{}
+	for k := range h.Meta.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fm = append(fm, yaml.MapItem{Key: k, Value: h.Meta.Fields[k]})
+	}
+
+	out, err := yaml.Marshal(fm)
+	if err != nil {
+		return "", err
+	}
+	if len(fm) == 0 {
+		out = []byte{}
+	}
+	return frontMatterDelimiter + "\n" + string(out) + frontMatterDelimiter + "\n", nil
+}
+
+// Render formats the header in the given format, returning an error if the
+// format cannot hold everything in the header
+func (h Header) Render(format HeaderFormat) (string, error) {
+	switch format {
+	case BracketHeader:
+		return h.bracketString()
+	case FrontMatterHeader:
+		return h.frontMatterString()
+	}
+	return "", fmt.Errorf("Unknown header format %d", format)
+}
+
+// MigrateHeader rewrites the header of the note in the given format, leaving
+// the rest of the note untouched. It returns false if the note already uses
+// the format or has no header.
+func (m *Manager) MigrateHeader(note Note, format HeaderFormat, dryRun bool) (bool, error) {
+	content, err := ioutil.ReadFile(note.Path)
+	if err != nil {
+		return false, err
+	}
+
+	h, body, err := parseHeader(string(content))
+	if err != nil {
+		return false, err
+	}
+	if h.Format == format || h.Format == NoHeader {
+		return false, nil
+	}
+	header, err := h.Render(format)
+	if err != nil {
+		return false, err
+	}
+	if dryRun {
+		return true, nil
+	}
+	m.markChangedPath(note.Path)
+	return true, ioutil.WriteFile(note.Path, []byte(header+body), 0644)
+}
@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHeader(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		format  HeaderFormat
+		id      int
+		tags    []string
+		body    string
+		err     bool
+	}{
+		{"bracket", "[@3, #work, #k8s]\nbody\n", BracketHeader, 3, []string{"work", "k8s"}, "body\n", false},
+		{"bracket without a body", "[@3]", BracketHeader, 3, []string{}, "", false},
+		{"front matter", "---\nid: 4\ntags: [work, home]\n---\nbody\n", FrontMatterHeader, 4, []string{"work", "home"}, "body\n", false},
+		{"front matter with a tag string", "---\nid: 4\ntags: work\n---\nbody\n", FrontMatterHeader, 4, []string{"work"}, "body\n", false},
+		{"front matter with a block list", "---\nid: 4\ntags:\n  - work\n  - home\n---\n", FrontMatterHeader, 4, []string{"work", "home"}, "", false},
+		{"invalid yaml", "---\nid: 4\ntags: [work\n---\nbody\n", FrontMatterHeader, -1, []string{}, "body\n", true},
+		{"yaml of the wrong type", "---\nid: four\n---\nbody\n", FrontMatterHeader, -1, []string{}, "body\n", true},
+		{"unclosed front matter", "---\nid: 4\nbody\n", NoHeader, -1, []string{}, "---\nid: 4\nbody\n", false},
+		{"no header", "# Title\nbody\n", NoHeader, -1, []string{}, "# Title\nbody\n", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h, body, err := parseHeader(test.content)
+			if (err != nil) != test.err {
+				t.Errorf("parseHeader returned the error %v", err)
+			}
+			if h.Format != test.format || h.Id != test.id || !reflect.DeepEqual(h.Tags, test.tags) {
+				t.Errorf("parseHeader returned %+v", h)
+			}
+			if body != test.body {
+				t.Errorf("The body is %q, want %q", body, test.body)
+			}
+		})
+	}
+}
+
+func TestParseHeaderCreated(t *testing.T) {
+	h, _, err := parseHeader("---\nid: 1\ncreated: 2026-10-17\n---\n")
+	if err != nil || !h.Meta.Created.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("created is %v, %v", h.Meta.Created, err)
+	}
+
+	// A date in another layout is kept as it was written instead of losing
+	// the whole header
+	h, _, err = parseHeader("---\nid: 1\ntags: [work]\ncreated: 2026-10-17 09:30\n---\n")
+	if err != nil || h.Id != 1 || !reflect.DeepEqual(h.Tags, []string{"work"}) {
+		t.Fatalf("parseHeader returned %+v, %v", h, err)
+	}
+	if !h.Meta.Created.IsZero() || h.Meta.Fields["created"] != "2026-10-17 09:30" {
+		t.Errorf("created is %v, the fields are %v", h.Meta.Created, h.Meta.Fields)
+	}
+}
+
+func TestRenderHeader(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		// How the header is rendered, if it is not rendered as written
+		rendered string
+	}{
+		{"[@3, #work, #k8s]\n", ""},
+		{"[@3, draft]\n", ""},
+		{"[]\n", ""},
+		{"---\nid: 4\ntags:\n- work\n- home\n---\n", ""},
+		{"---\nid: 4\ntags: [work, home]\n---\n", "---\nid: 4\ntags:\n- work\n- home\n---\n"},
+		{
+			"---\nid: 4\ncreated: \"2026-10-17\"\naliases:\n- plan\nstatus: active\nsource: https://example.com\nextra: 5\n---\n",
+			"",
+		},
+		// Dates are quoted so they are read back as strings
+		{"---\nid: 4\ncreated: 2026-10-17T09:30:00Z\n---\n", "---\nid: 4\ncreated: \"2026-10-17T09:30:00Z\"\n---\n"},
+		{"---\nid: 4\ncreated: 2026-10-17 09:30\n---\n", ""},
+		{"---\n---\n", ""},
+	} {
+		h, body, err := parseHeader(test.header + "body\n")
+		if err != nil || body != "body\n" {
+			t.Fatalf("parseHeader(%q) returned %q, %v", test.header, body, err)
+		}
+		rendered, err := h.Render(h.Format)
+		want := test.rendered
+		if want == "" {
+			want = test.header
+		}
+		if err != nil || rendered != want {
+			t.Errorf("Rendering %q gave %q, %v, want %q", test.header, rendered, err, want)
+		}
+
+		reparsed, _, err := parseHeader(rendered)
+		if err != nil || !reflect.DeepEqual(reparsed, h) {
+			t.Errorf("%q was parsed as %+v, and after rendering as %+v, %v", test.header, h, reparsed, err)
+		}
+	}
+}
+
+func TestRenderHeaderBetweenFormats(t *testing.T) {
+	bracket := "[@3, #work, #k8s]\n"
+	h, _, _ := parseHeader(bracket)
+	frontMatter, err := h.Render(FrontMatterHeader)
+	if err != nil || frontMatter != "---\nid: 3\ntags:\n- work\n- k8s\n---\n" {
+		t.Fatalf("Render(FrontMatterHeader) returned %q, %v", frontMatter, err)
+	}
+	h, _, _ = parseHeader(frontMatter)
+	back, err := h.Render(BracketHeader)
+	if err != nil || back != bracket {
+		t.Errorf("Render(BracketHeader) returned %q, %v", back, err)
+	}
+
+	// Only front matter can hold metadata or custom fields
+	h, _, _ = parseHeader("---\nid: 3\nstatus: active\n---\n")
+	if _, err := h.Render(BracketHeader); err == nil {
+		t.Errorf("A bracket header should not hold a status")
+	}
+	h, _, _ = parseHeader("[@3, draft]\n")
+	if _, err := h.Render(FrontMatterHeader); err == nil || !strings.Contains(err.Error(), "draft") {
+		t.Errorf("Front matter should not hold the item 'draft', got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	stateDir      = ".note-taker"
+	lockFile      = "lock"
+	lockRetry     = 50 * time.Millisecond
+	lockTimeout   = 10 * time.Second
+	lockStaleTime = time.Minute
+)
+
+func (m *Manager) statePath(name string) string {
+	return m.getPath(stateDir + "/" + name)
+}
+
+// ensureStateDir creates the directory holding the lock and the index, which
+// ignores itself so that it is never committed along with the notes
+func (m *Manager) ensureStateDir() error {
+	err := os.MkdirAll(m.statePath(""), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	ignore := m.statePath(".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		return ioutil.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+	return nil
+}
+
+// lock takes an exclusive lock on the notes directory so that concurrent
+// invocations do not allocate the same id, the returned function releases it
+func (m *Manager) lock() (func(), error) {
+	err := m.ensureStateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	path := m.statePath(lockFile)
+	start := time.Now()
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		// A lock left behind by a process that died is removed, since no
+		// command holds the lock for longer than it takes to write a header
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStaleTime {
+			os.Remove(path)
+			continue
+		}
+		if time.Since(start) > lockTimeout {
+			return nil, fmt.Errorf("Timed out waiting for lock '%s'", path)
+		}
+		time.Sleep(lockRetry)
+	}
+}
+
+func maxId(notes []Note) int {
+	max := 0
+	for _, note := range notes {
+		if note.Id > max {
+			max = note.Id
+		}
+	}
+	return max
+}
+
+// maxTrashedId returns the highest id of the notes in the trash, so that their
+// ids are not given out again while they can still be restored
+func (m *Manager) maxTrashedId() (int, error) {
+	trashed, err := m.ListTrash()
+	if err != nil {
+		return -1, err
+	}
+	max := 0
+	for _, t := range trashed {
+		// The note is always the first file, followed by its attachments
+		content, err := ioutil.ReadFile(m.trashPath(t.Dir + "/" + t.Files[0]))
+		if err != nil {
+			return -1, err
+		}
+		// A trashed note with an invalid header has no id to reserve
+		h, _, _ := parseHeader(string(content))
+		if h.Id > max {
+			max = h.Id
+		}
+	}
+	return max, nil
+}
+
+// NextId returns one more than the highest id of any note in any notebook or
+// in the trash, it should only be called while holding the lock
+func (m *Manager) NextId() (int, error) {
+	notes, err := m.listNotes("", nil)
+	if err != nil {
+		return -1, err
+	}
+	max, err := m.maxTrashedId()
+	if err != nil {
+		return -1, err
+	}
+	if id := maxId(notes); id > max {
+		max = id
+	}
+	return max + 1, nil
+}
+
+// IdProblem is a note with a missing or duplicate id and the id it is given,
+// or a note whose header cannot be parsed, which is left alone and has a
+// NewId of -1
+type IdProblem struct {
+	Note  Note
+	NewId int
+}
+
+func (p IdProblem) String() string {
+	if p.Note.HeaderError != "" {
+		return fmt.Sprintf("%s: %s, skipping", p.Note.Title, p.Note.HeaderError)
+	}
+	if p.Note.Id == -1 {
+		return fmt.Sprintf("%s: missing id, assigning @%d", p.Note.Title, p.NewId)
+	}
+	return fmt.Sprintf("%s: duplicate id @%d, assigning @%d", p.Note.Title, p.Note.Id, p.NewId)
+}
+
+// setHeaderId replaces the id in the header of the note at path, adding a
+// header if the note does not have one
+func setHeaderId(path string, id int) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	h, body, err := parseHeader(string(content))
+	if err != nil {
+		return err
+	}
+	h.Id = id
+	if h.Format == NoHeader {
+		h.Format = BracketHeader
+	}
+	header, err := h.Render(h.Format)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(header+body), 0644)
+}
+
+// Fsck finds notes with a missing or duplicated id and gives each of them a
+// new unique id. When there are duplicates, the note that was modified first
+// keeps the id. Ids are unique across notebooks, so every notebook is checked.
+// If dryRun is set the problems are returned without being repaired.
+func (m *Manager) Fsck(dryRun bool) ([]IdProblem, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	notes, err := m.listNotes("", nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].ModTime.Before(notes[j].ModTime)
+	})
+
+	problems := []IdProblem{}
+	next, err := m.NextId()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	for _, note := range notes {
+		if note.HeaderError != "" {
+			// Adding an id would put a second header above the one
+			// that could not be parsed
+			problems = append(problems, IdProblem{note, -1})
+			continue
+		}
+		if note.Id != -1 && !seen[note.Id] {
+			seen[note.Id] = true
+			continue
+		}
+		problems = append(problems, IdProblem{note, next})
+		next += 1
+	}
+
+	if dryRun {
+		return problems, nil
+	}
+	for _, p := range problems {
+		if p.NewId == -1 {
+			continue
+		}
+		m.markChangedPath(p.Note.Path)
+		err = setHeaderId(p.Note.Path, p.NewId)
+		if err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
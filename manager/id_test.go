@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextIdSkipsTrashedNotes(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1]\n")
+	writeNote(t, m, "work/B.md", "[@4]\n")
+	writeNote(t, m, "C.md", "---\nid: 7\n---\n")
+	if err := m.Delete("C"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trashed note may still be restored, so its id is not given out
+	if id, err := m.NextId(); err != nil || id != 8 {
+		t.Errorf("NextId returned %d, %v, want 8", id, err)
+	}
+	name, err := m.Create("D", func(id int) (string, error) {
+		return fmt.Sprintf("[@%d]\n", id), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := readNote(t, m, name+".md"); content != "[@8]\n" {
+		t.Errorf("The new note is %q", content)
+	}
+
+	if _, err := m.EmptyTrash(0); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := m.NextId(); err != nil || id != 9 {
+		t.Errorf("NextId returned %d, %v, want 9", id, err)
+	}
+}
+
+func TestFsckKeepsIdOfFirstModifiedNote(t *testing.T) {
+	m := newTestManager(t)
+	now := time.Now()
+	for i, note := range []struct {
+		name    string
+		content string
+	}{
+		{"Old.md", "[@1, #work]\nold\n"},
+		{"work/Copy.md", "[@1, #work]\ncopy\n"},
+		{"Missing.md", "no header\n"},
+		{"Other.md", "---\nid: 2\n---\nother\n"},
+		{"Newest.md", "---\nid: 2\ntags: [home]\n---\nnewest\n"},
+	} {
+		writeNote(t, m, note.name, note.content)
+		modified := now.Add(time.Duration(i-10) * time.Hour)
+		if err := os.Chtimes(filepath.Join(m.Dir, note.name), modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	problems, err := m.Fsck(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	want := []string{
+		"Copy: duplicate id @1, assigning @3",
+		"Missing: missing id, assigning @4",
+		"Newest: duplicate id @2, assigning @5",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Fsck found %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Fsck found %q, want %q", got[i], want[i])
+		}
+	}
+	if content := readNote(t, m, "work/Copy.md"); content != "[@1, #work]\ncopy\n" {
+		t.Errorf("A dry run changed the note to %q", content)
+	}
+
+	if _, err := m.Fsck(false); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"Old.md":       "[@1, #work]\nold\n",
+		"work/Copy.md": "[@3, #work]\ncopy\n",
+		"Missing.md":   "[@4]\nno header\n",
+		"Other.md":     "---\nid: 2\n---\nother\n",
+		"Newest.md":    "---\nid: 5\ntags:\n- home\n---\nnewest\n",
+	} {
+		if got := readNote(t, m, name); got != content {
+			t.Errorf("%s is %q, want %q", name, got, content)
+		}
+	}
+
+	if problems, err := m.Fsck(false); err != nil || len(problems) != 0 {
+		t.Errorf("Fsck found %+v, %v after repairing", problems, err)
+	}
+}
+
+func TestFsckSkipsInvalidHeaders(t *testing.T) {
+	m := newTestManager(t)
+	invalid := "---\nid: 1\ntags: [work\n---\nbody\n"
+	writeNote(t, m, "Invalid.md", invalid)
+
+	problems, err := m.Fsck(false)
+	if err != nil || len(problems) != 1 || problems[0].NewId != -1 {
+		t.Fatalf("Fsck returned %+v, %v", problems, err)
+	}
+	// An id added above the front matter would hide it for good
+	if content := readNote(t, m, "Invalid.md"); content != invalid {
+		t.Errorf("Fsck rewrote the note to %q", content)
+	}
+}
+
+func TestLockBreaksStaleLock(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, stateDir+"/"+lockFile, "")
+	stale := time.Now().Add(-2 * lockStaleTime)
+	if err := os.Chtimes(m.statePath(lockFile), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	unlock, err := m.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > lockTimeout/2 {
+		t.Errorf("Took %v to break the stale lock", waited)
+	}
+	unlock()
+	if _, err := os.Stat(m.statePath(lockFile)); !os.IsNotExist(err) {
+		t.Errorf("The lock was not released: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	indexFile = "index"
+	// indexVersion is increased whenever what is stored for a note changes,
+	// or headers are parsed differently, so that an index written by an
+	// older version is rebuilt instead of being trusted
+	indexVersion = 2
+)
+
+type indexEntry struct {
+	Id      int
+	Tags    []string
+	ModTime time.Time
+	Size    int64
+	Hash    string
+	Meta    Metadata
+	// Why the header could not be parsed, empty if it was
+	HeaderError string
+}
+
+// noteIndex caches the header of every note, keyed by its path relative to the
+// notes directory, so notes only need to be read again when their
+// modification time or size changes
+type noteIndex struct {
+	Version int
+	Notes   map[string]*indexEntry
+}
+
+type cachedContent struct {
+	Hash  string
+	Lines []string
+}
+
+func hashContent(content []byte) string {
+	sum := sha1.Sum(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Manager) loadIndex() *noteIndex {
+	index := &noteIndex{}
+	content, err := ioutil.ReadFile(m.statePath(indexFile))
+	if err == nil {
+		// A corrupt index is discarded and rebuilt from the notes
+		json.Unmarshal(content, index)
+	}
+	if index.Version != indexVersion || index.Notes == nil {
+		index = &noteIndex{indexVersion, make(map[string]*indexEntry)}
+	}
+	return index
+}
+
+func (m *Manager) saveIndex(index *noteIndex) error {
+	content, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	err = m.ensureStateDir()
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a concurrent reader never sees a
+	// partially written index
+	file, err := ioutil.TempFile(m.statePath(""), indexFile+"-*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), m.statePath(indexFile))
+}
+
+func (m *Manager) indexNote(fileName string, f os.FileInfo) (*indexEntry, error) {
+	content, err := ioutil.ReadFile(m.getPath(fileName))
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := parseHeader(string(content))
+	headerError := ""
+	if err != nil {
+		headerError = err.Error()
+	}
+	return &indexEntry{h.Id, h.Tags, f.ModTime(), f.Size(), hashContent(content), h.Meta, headerError}, nil
+}
@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func listTags(t *testing.T, m *Manager) map[string][]string {
+	t.Helper()
+	notes, err := m.ListNotes(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := make(map[string][]string)
+	for _, note := range notes {
+		tags[note.FullName()] = note.Tags
+	}
+	return tags
+}
+
+// staleIndex lists the notes to build the index, then replaces the tags of
+// every note in it, so that reading the tags shows whether the index was used
+func staleIndex(t *testing.T, m *Manager, version int) {
+	t.Helper()
+	listTags(t, m)
+	index := m.loadIndex()
+	if len(index.Notes) == 0 {
+		t.Fatal("The index is empty")
+	}
+	for _, entry := range index.Notes {
+		entry.Tags = []string{"stale"}
+	}
+	index.Version = version
+	if err := m.saveIndex(index); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexIsUsed(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1, #work]\n")
+	staleIndex(t, m, indexVersion)
+
+	// Nothing about the note changed, so it is not read again
+	if tags := listTags(t, m); !reflect.DeepEqual(tags["A"], []string{"stale"}) {
+		t.Errorf("The tags are %v, the index was not used", tags)
+	}
+}
+
+func TestIndexRebuiltOnVersionChange(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1, #work]\n")
+	writeNote(t, m, "work/B.md", "---\ntags: [home]\n---\n")
+	staleIndex(t, m, indexVersion-1)
+
+	tags := listTags(t, m)
+	if !reflect.DeepEqual(tags["A"], []string{"work"}) || !reflect.DeepEqual(tags["work/B"], []string{"home"}) {
+		t.Errorf("The tags are %v, the old index was used", tags)
+	}
+	if index := m.loadIndex(); index.Version != indexVersion || len(index.Notes) != 2 {
+		t.Errorf("The rebuilt index is %+v", index)
+	}
+}
+
+func TestIndexCorrupt(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1, #work]\n")
+	listTags(t, m)
+	if err := ioutil.WriteFile(m.statePath(indexFile), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if tags := listTags(t, m); !reflect.DeepEqual(tags["A"], []string{"work"}) {
+		t.Errorf("The tags are %v", tags)
+	}
+}
+
+func TestIndexInvalidation(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		// Whether the modification time is changed along with the content
+		touch bool
+	}{
+		// The same size, so only the modification time shows the change
+		{"modification time", "[@1, #home]\n", true},
+		// The modification time is put back, so only the size shows it
+		{"size", "[@1, #home, #k8s]\n", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(t)
+			writeNote(t, m, "A.md", "[@1, #work]\n")
+			writeNote(t, m, "B.md", "[@2, #work]\n")
+			path := filepath.Join(m.Dir, "A.md")
+			modified := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+			staleIndex(t, m, indexVersion)
+
+			writeNote(t, m, "A.md", test.content)
+			if test.touch {
+				modified = modified.Add(time.Minute)
+			}
+			if err := os.Chtimes(path, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+
+			tags := listTags(t, m)
+			want, _, _ := parseHeader(test.content)
+			if !reflect.DeepEqual(tags["A"], want.Tags) {
+				t.Errorf("The tags of the changed note are %v, want %v", tags["A"], want.Tags)
+			}
+			if !reflect.DeepEqual(tags["B"], []string{"stale"}) {
+				t.Errorf("The unchanged note was read again, its tags are %v", tags["B"])
+			}
+		})
+	}
+}
+
+func TestIndexForgetsDeletedNotes(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1]\n")
+	writeNote(t, m, "work/B.md", "[@2]\n")
+	listTags(t, m)
+	if err := os.Remove(filepath.Join(m.Dir, "A.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Listing a notebook does not drop the notes it did not look at
+	m.Notebook = "work"
+	listTags(t, m)
+	if _, ok := m.loadIndex().Notes["A.md"]; !ok {
+		t.Errorf("A note outside of the listed notebook was dropped")
+	}
+
+	m.Notebook = ""
+	listTags(t, m)
+	if _, ok := m.loadIndex().Notes["A.md"]; ok {
+		t.Errorf("The deleted note is still indexed")
+	}
+}
@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JournalTag           = "journal"
+	DefaultJournalFormat = "2006-01-02"
+)
+
+// JournalTitle returns the title of the journal entry for date, format is a
+// time layout such as "2006-01-02" or "Journal Jan 2 2006"
+func JournalTitle(format string, date time.Time) (string, error) {
+	title := date.Format(format)
+	if strings.Contains(title, "_") {
+		return "", fmt.Errorf("Journal title '%s' may not contain any underscores", title)
+	}
+	if title == "" || strings.Contains(title, "/") {
+		return "", fmt.Errorf("Journal format '%s' does not give a valid title", format)
+	}
+	return title, nil
+}
+
+// ParseJournalDate returns the date of a journal entry from its title, or
+// from its created date if the title does not match the format
+func ParseJournalDate(format string, note Note) (time.Time, bool) {
+	date, err := time.Parse(format, note.Title)
+	if err == nil {
+		return date, true
+	}
+	if !note.Meta.Created.IsZero() {
+		return note.Meta.Created, true
+	}
+	return time.Time{}, false
+}
+
+// OpenJournal opens the journal entry for date in the editor, creating it
+// if it does not exist yet
+func (m *Manager) OpenJournal(format string, date time.Time) error {
+	title, err := JournalTitle(format, date)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(m.getPath(m.getFileName(title, "md", 0)))
+	if err == nil {
+		return m.Edit(title)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return m.CreateAndEdit(title, func(id int) (string, error) {
+		return m.NoteContent("", id, title, []string{JournalTag})
+	})
+}
+
+// JournalWeek returns the journal entries from the Monday to the Sunday of
+// the week containing date, in order
+func (m *Manager) JournalWeek(format string, date time.Time) ([]Note, error) {
+	entries := []Note{}
+	notes, err := m.ListNotes(nil)
+	if err != nil {
+		return entries, err
+	}
+	// Entries are created at the top of the notebook, an entry with the
+	// same title in a nested notebook is a different note
+	byName := make(map[string]Note)
+	for _, note := range notes {
+		byName[m.NoteName(note)] = note
+	}
+
+	// Weeks start on Monday, time.Sunday is 0
+	offset := (int(date.Weekday()) + 6) % 7
+	monday := date.AddDate(0, 0, -offset)
+	for i := 0; i < 7; i++ {
+		title, err := JournalTitle(format, monday.AddDate(0, 0, i))
+		if err != nil {
+			return entries, err
+		}
+		if note, ok := byName[title]; ok {
+			entries = append(entries, note)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,237 @@
+package manager
+
+import (
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// Link is a [[Target]] or [[Target|Label]] reference from one note to
+// another, the target is either a title, an alias or an id such as @42
+type Link struct {
+	Target string
+	Label  string
+	Line   int
+	// Byte offsets of the whole link in the note
+	Start int
+	End   int
+}
+
+// fenceOf returns the backticks or tildes that open a fenced code block if
+// line, without its indentation, starts one
+func fenceOf(line string) string {
+	for _, c := range "`~" {
+		run := strings.TrimLeft(line, string(c))
+		if n := len(line) - len(run); n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// codeSpans returns the byte ranges of the `code spans` in content between
+// start and end, a span ends at the next run of the same number of backticks
+func codeSpans(content string, start int, end int) [][2]int {
+	spans := [][2]int{}
+	runLength := func(i int) int {
+		n := 0
+		for i+n < end && content[i+n] == '`' {
+			n++
+		}
+		return n
+	}
+	for i := start; i < end; {
+		if content[i] != '`' {
+			i++
+			continue
+		}
+		n := runLength(i)
+		closing := -1
+		for j := i + n; j < end; {
+			if content[j] != '`' {
+				j++
+			} else if m := runLength(j); m == n {
+				closing = j
+				break
+			} else {
+				j += m
+			}
+		}
+		if closing == -1 {
+			i += n
+			continue
+		}
+		spans = append(spans, [2]int{i, closing + n})
+		i = closing + n
+	}
+	return spans
+}
+
+// codeRanges returns the byte ranges of the fenced code blocks and code spans
+// in content, where [[...]] is code rather than a link
+func codeRanges(content string) [][2]int {
+	ranges := [][2]int{}
+	fence := ""
+	fenceStart := 0
+	textStart := 0
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		start := offset
+		offset += len(line)
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) >= 4 {
+			continue
+		}
+		if fence == "" {
+			if f := fenceOf(trimmed); f != "" {
+				ranges = append(ranges, codeSpans(content, textStart, start)...)
+				fence = f
+				fenceStart = start
+			}
+		} else if strings.HasPrefix(trimmed, fence) && strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1])) == "" {
+			ranges = append(ranges, [2]int{fenceStart, offset})
+			fence = ""
+			textStart = offset
+		}
+	}
+	// An unclosed fence runs to the end of the note
+	if fence != "" {
+		return append(ranges, [2]int{fenceStart, len(content)})
+	}
+	return append(ranges, codeSpans(content, textStart, len(content))...)
+}
+
+// FindLinks returns the links in content in order, [[...]] in code spans and
+// fenced code blocks is not a link
+func FindLinks(content string) []Link {
+	links := []Link{}
+	code := codeRanges(content)
+	for _, match := range wikiLinkPattern.FindAllStringSubmatchIndex(content, -1) {
+		inCode := false
+		for _, r := range code {
+			inCode = inCode || (match[0] >= r[0] && match[0] < r[1])
+		}
+		if inCode {
+			continue
+		}
+		inner := content[match[2]:match[3]]
+		target, label := inner, inner
+		if i := strings.Index(inner, "|"); i != -1 {
+			target, label = inner[:i], inner[i+1:]
+		}
+		links = append(links, Link{
+			Target: strings.TrimSpace(target),
+			Label:  strings.TrimSpace(label),
+			Line:   strings.Count(content[:match[0]], "\n"),
+			Start:  match[0],
+			End:    match[1],
+		})
+	}
+	return links
+}
+
+// ResolveLink finds the note a link target refers to, by id, then by title or
+// by title prefixed with its notebook, such as projects/Plan, and then by
+// alias, ignoring case for titles and aliases
+func ResolveLink(notes []Note, target string) (Note, bool) {
+	if strings.HasPrefix(target, "@") {
+		if id, err := strconv.Atoi(target[1:]); err == nil {
+			for _, note := range notes {
+				if note.Id == id {
+					return note, true
+				}
+			}
+			return Note{}, false
+		}
+	}
+	for _, note := range notes {
+		if note.Title == target || note.FullName() == target {
+			return note, true
+		}
+	}
+	for _, note := range notes {
+		if strings.EqualFold(note.Title, target) {
+			return note, true
+		}
+	}
+	for _, note := range notes {
+		for _, alias := range note.Meta.Aliases {
+			if strings.EqualFold(alias, target) {
+				return note, true
+			}
+		}
+	}
+	return Note{}, false
+}
+
+// renameLinks points links that target oldName at newName, keeping any label
+func renameLinks(content string, oldName string, newName string) string {
+	links := FindLinks(content)
+	for i := len(links) - 1; i >= 0; i-- {
+		l := links[i]
+		if !strings.EqualFold(l.Target, oldName) {
+			continue
+		}
+		replacement := "[[" + newName + "]]"
+		if l.Label != l.Target {
+			replacement = "[[" + newName + "|" + l.Label + "]]"
+		}
+		content = content[:l.Start] + replacement + content[l.End:]
+	}
+	return content
+}
+
+type ResolvedLink struct {
+	Link
+	// The full name of the note that is linked to, empty if the link is
+	// broken
+	Name string
+}
+
+// LinkGraph holds the links of each note by the full name of the note, since
+// titles are only unique within a notebook
+type LinkGraph struct {
+	Outgoing map[string][]ResolvedLink
+	// The full names of the notes linking to each note, in sorted order
+	Incoming map[string][]string
+}
+
+// BuildLinkGraph finds the links between notes, contents holds the content of
+// each note by path
+func BuildLinkGraph(notes []Note, contents map[string]string) *LinkGraph {
+	g := &LinkGraph{make(map[string][]ResolvedLink), make(map[string][]string)}
+	for _, note := range notes {
+		seen := make(map[string]bool)
+		for _, l := range FindLinks(contents[note.Path]) {
+			resolved := ResolvedLink{l, ""}
+			if target, ok := ResolveLink(notes, l.Target); ok {
+				resolved.Name = target.FullName()
+				if !seen[resolved.Name] && resolved.Name != note.FullName() {
+					seen[resolved.Name] = true
+					g.Incoming[resolved.Name] = append(g.Incoming[resolved.Name], note.FullName())
+				}
+			}
+			g.Outgoing[note.FullName()] = append(g.Outgoing[note.FullName()], resolved)
+		}
+	}
+	for _, titles := range g.Incoming {
+		sort.Strings(titles)
+	}
+	return g
+}
+
+func (m *Manager) LinkGraph(notes []Note) (*LinkGraph, error) {
+	contents := make(map[string]string)
+	for _, note := range notes {
+		content, err := ioutil.ReadFile(note.Path)
+		if err != nil {
+			return nil, err
+		}
+		contents[note.Path] = string(content)
+	}
+	return BuildLinkGraph(notes, contents), nil
+}
@@ -1,15 +1,101 @@
 package manager
 
-import "time"
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
 
 type Note struct {
-	Id      int
-	Title   string
-	Tags    []string
-	Path    string
-	ModTime time.Time
+	Id    int
+	Title string
+	// The directory the note is in relative to the notes directory, such as
+	// projects/foo, empty for notes at the top level
+	Notebook string
+	Tags     []string
+	Path     string
+	ModTime  time.Time
+	Size     int64
+	Hash     string
+	Meta     Metadata
+	// Why the header of the note could not be parsed, the note has no id or
+	// tags if it is set
+	HeaderError string
 }
 
 type Manager struct {
 	Dir string
+	// The notebook notes are listed from and created in, relative to Dir,
+	// every note is listed if it is empty
+	Notebook string
+	// The editor command and its arguments, $EDITOR or vim are used if it
+	// is empty
+	Editor []string
+	// How notes are ranked when searching, the defaults are used if nil
+	Search *SearchWeights
+	// Settings from outside the notes directory, combined with the settings
+	// file of the notes directory by LoadSettings
+	UserSettings Settings
+
+	// Contents of notes that have already been read, keyed by path
+	contents map[string]cachedContent
+	// Files written, moved or removed by the manager, relative to Dir
+	changed []string
+}
+
+// FullName is the title of the note prefixed by its notebook, which unlike
+// the title is unique across notebooks
+func (n Note) FullName() string {
+	return path.Join(n.Notebook, n.Title)
+}
+
+// NoteAnchor is the id of the element a note is rendered in, used to link to
+// the note in the generated html, name is the full name of the note
+func NoteAnchor(name string) string {
+	return "id_n_" + strings.ReplaceAll(name, " ", "_")
+}
+
+// inNotebook returns the path relative to Dir of name, which is relative to
+// the notebook of the manager
+func (m *Manager) inNotebook(name string) string {
+	if m.Notebook == "" {
+		return name
+	}
+	return m.Notebook + "/" + name
+}
+
+// fromNotebook is the reverse of inNotebook
+func (m *Manager) fromNotebook(name string) string {
+	if m.Notebook == "" {
+		return name
+	}
+	return strings.TrimPrefix(name, m.Notebook+"/")
+}
+
+// markChanged records that the file or directory name, relative to Dir, was
+// written, moved or removed
+func (m *Manager) markChanged(name string) {
+	m.changed = append(m.changed, name)
+}
+
+// markChangedPath is markChanged for a path in Dir, such as the path of a note
+func (m *Manager) markChangedPath(p string) {
+	rel, err := filepath.Rel(m.Dir, p)
+	if err == nil {
+		m.markChanged(filepath.ToSlash(rel))
+	}
+}
+
+// ChangedFiles returns the files, relative to Dir, that were written, moved or
+// removed through the manager, so that a command can commit only the files it
+// changed
+func (m *Manager) ChangedFiles() []string {
+	return m.changed
+}
+
+// NoteName is the name commands refer to the note by, its title prefixed by
+// the notebooks it is nested in below the notebook of the manager
+func (m *Manager) NoteName(note Note) string {
+	return m.fromNotebook(note.FullName())
 }
@@ -0,0 +1,33 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	return &Manager{Dir: t.TempDir()}
+}
+
+// writeNote writes a file in the notes directory, name is relative to it
+func writeNote(t *testing.T, m *Manager, name string, content string) {
+	t.Helper()
+	path := filepath.Join(m.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readNote(t *testing.T, m *Manager, name string) string {
+	t.Helper()
+	content, err := ioutil.ReadFile(filepath.Join(m.Dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
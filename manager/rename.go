@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// attachments returns the file names of the files created by Move for the
+// note called name, which are called either name.ext or name(n).ext and are
+// in the same notebook as the note
+func (m *Manager) attachments(name string) ([]string, error) {
+	dir := path.Dir(m.getFileName(name, "md", 0))
+	name = path.Base(name)
+	files, err := ioutil.ReadDir(m.getPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(name) + `(\(([0-9]+)\))?\.[^.]+$`)
+	names := []string{}
+	duplicates := map[string]int{}
+	for _, f := range files {
+		n := f.Name()
+		match := pattern.FindStringSubmatch(n)
+		if match == nil || f.IsDir() || strings.HasSuffix(n, ".md") {
+			continue
+		}
+		// name(n).ext belongs to the note name(n) if there is one
+		if _, err := os.Stat(m.getPath(path.Join(dir, name+match[1]+".md"))); match[1] != "" && err == nil {
+			continue
+		}
+		n = path.Join(dir, n)
+		names = append(names, n)
+		duplicates[n], _ = strconv.Atoi(match[2])
+	}
+
+	// Keep the attachments in the order they were moved in, so that they
+	// keep the same suffixes after being renamed
+	sort.SliceStable(names, func(i, j int) bool {
+		return duplicates[names[i]] < duplicates[names[j]]
+	})
+	return names, nil
+}
+
+// escapePath escapes each part of a path relative to the notes directory as
+// it would be in a link
+func escapePath(fileName string) string {
+	parts := strings.Split(fileName, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func extension(fileName string) string {
+	components := strings.Split(fileName, ".")
+	return components[len(components)-1]
+}
+
+// replaceReference replaces every occurrence of old in content that is not
+// followed by a character that could continue the reference, so renaming
+// 'Foo' does not change references to 'Foo Bar'
+func replaceReference(content string, old string, new string) string {
+	pattern := regexp.MustCompile(regexp.QuoteMeta(old) + `([^A-Za-z0-9_(%-]|$)`)
+	return pattern.ReplaceAllString(content, strings.ReplaceAll(new, "$", "$$")+"${1}")
+}
+
+// Rename renames the note called oldName to newName, along with any
+// attachments that were moved in with the note's title, and rewrites links to
+// the note and its attachments, including [[wiki links]], in every note of
+// every notebook. If newName is taken the note is given a (2), (3), ...
+// suffix, the name that was used is returned. Renaming a note to its own name
+// does nothing.
+func (m *Manager) Rename(oldName string, newName string) (string, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	oldFile := m.getFileName(oldName, "md", 0)
+	_, err = os.Stat(m.getPath(oldFile))
+	if err != nil {
+		return "", err
+	}
+	if m.getFileName(newName, "md", 0) == oldFile {
+		return oldName, nil
+	}
+	newFile, err := m.freeFileName(newName, "md")
+	if err != nil {
+		return "", err
+	}
+	// The new name may be in a notebook that does not exist yet, attachments
+	// are renamed into the same directory as the note
+	err = os.MkdirAll(filepath.Dir(m.getPath(newFile)), os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	newTitle := m.fromNotebook(strings.TrimSuffix(newFile, ".md"))
+
+	notes, err := m.listNotes("", nil)
+	if err != nil {
+		return "", err
+	}
+	// Links by title alone only refer to the note if no other note with the
+	// same title is found first
+	target, _ := ResolveLink(notes, path.Base(oldName))
+	ownsTitle := target.Path == m.getPath(oldFile)
+
+	// Maps each renamed file to its new name
+	renamed := map[string]string{}
+	attachments, err := m.attachments(oldName)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range attachments {
+		newAttachment, err := m.freeFileName(newTitle, extension(a))
+		if err != nil {
+			return "", err
+		}
+		m.markChanged(a)
+		m.markChanged(newAttachment)
+		err = os.Rename(m.getPath(a), m.getPath(newAttachment))
+		if err != nil {
+			return "", err
+		}
+		renamed[a] = newAttachment
+	}
+	m.markChanged(oldFile)
+	m.markChanged(newFile)
+	err = os.Rename(m.getPath(oldFile), m.getPath(newFile))
+	if err != nil {
+		return "", err
+	}
+	renamed[oldFile] = newFile
+
+	notes, err = m.listNotes("", nil)
+	if err != nil {
+		return newTitle, err
+	}
+	for _, note := range notes {
+		content, err := ioutil.ReadFile(note.Path)
+		if err != nil {
+			return newTitle, err
+		}
+
+		updated := string(content)
+		for oldRef, newRef := range renamed {
+			updated = replaceReference(updated, NotesDirKey+"/"+oldRef, NotesDirKey+"/"+newRef)
+			updated = replaceReference(
+				updated,
+				NotesDirKey+"/"+escapePath(oldRef),
+				NotesDirKey+"/"+escapePath(newRef),
+			)
+		}
+		updated = replaceReference(updated, "#"+NoteAnchor(m.inNotebook(oldName)), "#"+NoteAnchor(m.inNotebook(newTitle)))
+		if ownsTitle {
+			updated = renameLinks(updated, path.Base(oldName), path.Base(newTitle))
+		}
+		updated = renameLinks(updated, m.inNotebook(oldName), m.inNotebook(newTitle))
+
+		if updated != string(content) {
+			m.markChangedPath(note.Path)
+			err = ioutil.WriteFile(note.Path, []byte(updated), 0644)
+			if err != nil {
+				return newTitle, err
+			}
+		}
+	}
+
+	return newTitle, nil
+}
@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "Foo.md", "[@1]\nfoo\n")
+	writeNote(t, m, "Foo.png", "first")
+	writeNote(t, m, "Foo(2).png", "second")
+	writeNote(t, m, "Foo Bar.md", "[@2]\n")
+	writeNote(t, m, "Foo Bar.png", "other")
+	writeNote(t, m, "work/Ref.md", "[@3]\n"+
+		"![one]($NOTES/Foo.png) ![two]($NOTES/Foo(2).png) ![other]($NOTES/Foo%20Bar.png)\n"+
+		"[link]($NOTES/Foo.md) [bar]($NOTES/Foo%20Bar.md)\n"+
+		"[anchor](#id_n_Foo) [other](#id_n_Foo_Bar)\n"+
+		"[[Foo]] [[foo|the foo]] [[Foo Bar]] `[[Foo]]`\n"+
+		"```\n[[Foo]]\n```\n")
+
+	name, err := m.Rename("Foo", "New Name")
+	if err != nil || name != "New Name" {
+		t.Fatalf("Rename returned %q, %v", name, err)
+	}
+
+	want := "[@3]\n" +
+		"![one]($NOTES/New Name.png) ![two]($NOTES/New Name(2).png) ![other]($NOTES/Foo%20Bar.png)\n" +
+		"[link]($NOTES/New Name.md) [bar]($NOTES/Foo%20Bar.md)\n" +
+		"[anchor](#id_n_New_Name) [other](#id_n_Foo_Bar)\n" +
+		"[[New Name]] [[New Name|the foo]] [[Foo Bar]] `[[Foo]]`\n" +
+		"```\n[[Foo]]\n```\n"
+	if content := readNote(t, m, "work/Ref.md"); content != want {
+		t.Errorf("The references are\n%s\nwant\n%s", content, want)
+	}
+
+	// The attachments keep their order, and those of Foo Bar are left alone
+	for file, content := range map[string]string{
+		"New Name.md":     "[@1]\nfoo\n",
+		"New Name.png":    "first",
+		"New Name(2).png": "second",
+		"Foo Bar.png":     "other",
+	} {
+		if got := readNote(t, m, file); got != content {
+			t.Errorf("%s is %q, want %q", file, got, content)
+		}
+	}
+	for _, file := range []string{"Foo.md", "Foo.png", "Foo(2).png"} {
+		if _, err := os.Stat(filepath.Join(m.Dir, file)); !os.IsNotExist(err) {
+			t.Errorf("%s was not moved: %v", file, err)
+		}
+	}
+}
+
+func TestRenameBetweenNotebooks(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "work/Old Plan.md", "[@1]\n")
+	writeNote(t, m, "work/Old Plan.jpg", "image")
+	writeNote(t, m, "Ref.md", "[[Old Plan]] [[work/Old Plan]]\n"+
+		"![img]($NOTES/work/Old%20Plan.jpg) [plan](#id_n_work/Old_Plan)\n")
+
+	name, err := m.Rename("work/Old Plan", "archive/Plan")
+	if err != nil || name != "archive/Plan" {
+		t.Fatalf("Rename returned %q, %v", name, err)
+	}
+	want := "[[Plan]] [[archive/Plan]]\n" +
+		"![img]($NOTES/archive/Plan.jpg) [plan](#id_n_archive/Plan)\n"
+	if content := readNote(t, m, "Ref.md"); content != want {
+		t.Errorf("The references are\n%s\nwant\n%s", content, want)
+	}
+	if content := readNote(t, m, "archive/Plan.jpg"); content != "image" {
+		t.Errorf("The attachment is %q", content)
+	}
+}
+
+func TestRenameTitleOwnedByAnotherNote(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "Plan.md", "[@1]\n")
+	writeNote(t, m, "work/Plan.md", "[@2]\n")
+	writeNote(t, m, "Ref.md", "[[Plan]] [[work/Plan]]\n")
+
+	// [[Plan]] refers to the note at the top of the notes directory
+	if _, err := m.Rename("work/Plan", "work/Roadmap"); err != nil {
+		t.Fatal(err)
+	}
+	if content := readNote(t, m, "Ref.md"); content != "[[Plan]] [[work/Roadmap]]\n" {
+		t.Errorf("The references are %q", content)
+	}
+}
+
+func TestRenameToTakenName(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "A.md", "[@1]\n")
+	writeNote(t, m, "B.md", "[@2]\n")
+
+	name, err := m.Rename("A", "A")
+	if err != nil || name != "A" || readNote(t, m, "A.md") != "[@1]\n" {
+		t.Errorf("Renaming a note to its own name returned %q, %v", name, err)
+	}
+
+	name, err = m.Rename("A", "B")
+	if err != nil || name != "B(2)" {
+		t.Fatalf("Rename returned %q, %v", name, err)
+	}
+	if readNote(t, m, "B(2).md") != "[@1]\n" || readNote(t, m, "B.md") != "[@2]\n" {
+		t.Errorf("The note was not renamed to B(2)")
+	}
+}
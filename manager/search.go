@@ -1,22 +1,50 @@
 package manager
 
 import (
-	"bufio"
-	"io/ioutil"
+	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
-const (
-	maxNonMatchPenalty = -100.0
-	maxMatchScore      = 250.0
-	dateWeight         = 10.0
-	datePenaltyCeil    = 100.0
-	secondsInDay       = 86400.0
-)
+const secondsInDay = 86400.0
+
+// SearchWeights tune how notes are ranked, both when searching titles and
+// when searching the full text of notes
+type SearchWeights struct {
+	// The score of a title that matches the search, and the penalty for one
+	// that does not
+	MatchScore      float64 `toml:"match_score"`
+	NonMatchPenalty float64 `toml:"non_match_penalty"`
+	// The penalty for each day since a note was changed, up to the ceiling
+	DateWeight      float64 `toml:"date_weight"`
+	DatePenaltyCeil float64 `toml:"date_penalty_ceil"`
+	// How much more a match in the title of a note counts for in full text
+	// searches, along with the BM25 parameters
+	TitleBoost float64 `toml:"title_boost"`
+	BM25K1     float64 `toml:"bm25_k1"`
+	BM25B      float64 `toml:"bm25_b"`
+}
+
+var DefaultSearchWeights = SearchWeights{
+	MatchScore:      250.0,
+	NonMatchPenalty: -100.0,
+	DateWeight:      10.0,
+	DatePenaltyCeil: 100.0,
+	TitleBoost:      3.0,
+	BM25K1:          1.2,
+	BM25B:           0.75,
+}
+
+func (m *Manager) searchWeights() SearchWeights {
+	if m.Search == nil {
+		return DefaultSearchWeights
+	}
+	return *m.Search
+}
 
 func getMatching(entry, searchKey string) int {
 	entry = strings.ToLower(entry)
@@ -35,14 +63,14 @@ func getMatching(entry, searchKey string) int {
 	return matching
 }
 
-func getScore(note Note, searchKey string, curTime time.Time) float64 {
+func getScore(note Note, searchKey string, curTime time.Time, w SearchWeights) float64 {
 	numMatching := getMatching(note.Title, searchKey)
 	percentMatching := float64(numMatching) / float64(len(note.Title))
-	matchingScore := percentMatching*maxMatchScore + (1.0-percentMatching)*maxNonMatchPenalty
+	matchingScore := percentMatching*w.MatchScore + (1.0-percentMatching)*w.NonMatchPenalty
 
-	datePenalty := (curTime.Sub(note.ModTime).Seconds() / secondsInDay) * dateWeight
-	if datePenalty > datePenaltyCeil {
-		datePenalty = datePenaltyCeil
+	datePenalty := (curTime.Sub(note.ModTime).Seconds() / secondsInDay) * w.DateWeight
+	if datePenalty > w.DatePenaltyCeil {
+		datePenalty = w.DatePenaltyCeil
 	}
 
 	return matchingScore - datePenalty
@@ -62,8 +90,9 @@ func fullMatch(s string, prefix string) bool {
 	return true
 }
 
-func SortNotes(notes []Note, searchKey string) {
+func (m *Manager) SortNotes(notes []Note, searchKey string) {
 	t := time.Now()
+	w := m.searchWeights()
 	sort.SliceStable(notes, func(i, j int) bool {
 		iMatch := fullMatch(notes[i].Title, searchKey)
 		jMatch := fullMatch(notes[j].Title, searchKey)
@@ -72,7 +101,7 @@ func SortNotes(notes []Note, searchKey string) {
 		} else if !iMatch && jMatch {
 			return false
 		}
-		return getScore(notes[i], searchKey, t) > getScore(notes[j], searchKey, t)
+		return getScore(notes[i], searchKey, t, w) > getScore(notes[j], searchKey, t, w)
 	})
 }
 
@@ -82,84 +111,97 @@ func SortNotesById(notes []Note) {
 	})
 }
 
-func (m *Manager) getTags(f os.FileInfo) (int, []string, error) {
-	id := -1
-	tags := []string{}
+// ListNotes returns every note in the notebook of the manager, including the
+// notebooks nested in it, whose tags match the query, a nil query matches
+// every note
+func (m *Manager) ListNotes(query TagQuery) ([]Note, error) {
+	return m.listNotes(m.Notebook, query)
+}
 
-	file, err := os.Open(m.getPath(f.Name()))
-	if err != nil {
-		return id, tags, err
+// listNotes lists the notes in notebook, a directory relative to Dir, and
+// every directory below it except dot directories, such as the trash, and the
+// templates directory
+func (m *Manager) listNotes(notebook string, query TagQuery) ([]Note, error) {
+	notes := []Note{}
+	root := m.Dir
+	if notebook != "" {
+		root = m.getPath(notebook)
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	scanner.Scan()
-	firstLine := strings.TrimSpace(scanner.Text())
-	err = scanner.Err()
-	if err != nil {
-		return id, tags, err
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return notes, fmt.Errorf("No notebook called '%s'", notebook)
 	}
 
-	if len(firstLine) < 2 || firstLine[0] != '[' || firstLine[len(firstLine)-1] != ']' {
-		return id, tags, nil
-	}
-	listItems := strings.Split(firstLine[1:len(firstLine)-1], ",")
-	for _, item := range listItems {
-		item = strings.TrimSpace(item)
-		if len(item) > 0 {
-			if item[0] == '#' {
-				tags = append(tags, item[1:])
-			} else if item[0] == '@' {
-				nid, err := strconv.Atoi(item[1:])
-				if err == nil {
-					id = nid
-				}
+	index := m.loadIndex()
+	changed := false
+	seen := make(map[string]bool)
+	// The trailing separator makes Walk follow root if it is a symlink
+	err := filepath.Walk(root+string(filepath.Separator), func(file string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(m.Dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if f.IsDir() {
+			isRoot := rel == "." || rel == notebook
+			if !isRoot && (strings.HasPrefix(f.Name(), ".") || rel == templatesDir) {
+				return filepath.SkipDir
 			}
+			return nil
+		}
+		if !strings.HasSuffix(rel, ".md") {
+			return nil
 		}
-	}
-
-	return id, tags, nil
-}
 
-func arraysOverlap(a []string, b []string, caseSensitive bool) bool {
-	for _, sa := range a {
-		for _, sb := range b {
-			if strings.ToLower(sa) == strings.ToLower(sb) {
-				return true
+		seen[rel] = true
+		entry, ok := index.Notes[rel]
+		if !ok || !entry.ModTime.Equal(f.ModTime()) || entry.Size != f.Size() {
+			entry, err = m.indexNote(rel, f)
+			if err != nil {
+				return err
 			}
+			index.Notes[rel] = entry
+			changed = true
 		}
-	}
-	return false
-}
-
-func (m *Manager) ListNotes(tags []string) ([]Note, error) {
-	notes := []Note{}
 
-	files, err := ioutil.ReadDir(m.Dir)
+		if query == nil || query.Matches(entry.Tags) {
+			dir := path.Dir(rel)
+			if dir == "." {
+				dir = ""
+			}
+			notes = append(notes, Note{
+				Id:          entry.Id,
+				Title:       strings.TrimSuffix(path.Base(rel), ".md"),
+				Notebook:    dir,
+				Tags:        entry.Tags,
+				Path:        m.getPath(rel),
+				ModTime:     entry.ModTime,
+				Size:        entry.Size,
+				Hash:        entry.Hash,
+				Meta:        entry.Meta,
+				HeaderError: entry.HeaderError,
+			})
+		}
+		return nil
+	})
 	if err != nil {
 		return notes, err
 	}
 
-	for _, f := range files {
-		n := f.Name()
-		if len(n) >= 3 && n[len(n)-3:] == ".md" {
-			id, fileTags, err := m.getTags(f)
-			if err != nil {
-				return notes, err
-			}
-
-			// TODO: We are doing an OR here, we should also support AND
-			if len(tags) == 0 || arraysOverlap(tags, fileTags, false) {
-				notes = append(notes, Note{
-					id,
-					n[:len(n)-3],
-					fileTags,
-					m.getPath(f.Name()),
-					f.ModTime(),
-				})
-			}
+	for n := range index.Notes {
+		// Notes outside of the notebook were not looked at
+		inNotebook := notebook == "" || strings.HasPrefix(n, notebook+"/")
+		if inNotebook && !seen[n] {
+			delete(index.Notes, n)
+			changed = true
 		}
 	}
+	if changed {
+		// The index is only a cache, so failing to save it is not fatal
+		m.saveIndex(index)
+	}
 
 	return notes, nil
 }
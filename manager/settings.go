@@ -0,0 +1,152 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Settings for a notes directory are kept alongside the notes, so that they
+// are shared by everyone using the directory
+const (
+	settingsFile    = ".note-taker.json"
+	defaultHTMLFile = "index.html"
+)
+
+// Export is an html file holding every note that matches a tag query
+type Export struct {
+	File string `json:"file"`
+	Tags string `json:"tags"`
+}
+
+type Settings struct {
+	Exports []Export `json:"exports"`
+	// The names of the markdown extensions used when rendering html, if not
+	// set the defaults are used
+	MarkdownExtensions []string `json:"markdown_extensions"`
+	// Whether commands that change notes commit the change, if the notes
+	// directory is a git repository. Not committing is the default.
+	AutoCommit *bool `json:"auto_commit"`
+	// Where the html of every note is written, index.html by default
+	HTMLFile string `json:"html_file"`
+	// The layout of journal entry titles as a Go time layout, used both to
+	// create entries and to place them in the html calendar, 2006-01-02 by
+	// default
+	JournalFormat string `json:"journal_format"`
+}
+
+func (s Settings) AutoCommitEnabled() bool {
+	return s.AutoCommit != nil && *s.AutoCommit
+}
+
+// LoadSettings reads the settings file of the notes directory, the user
+// settings of the manager take precedence over it, and their exports are
+// added to those of the file
+func (m *Manager) LoadSettings() (Settings, error) {
+	var s Settings
+	content, err := ioutil.ReadFile(m.getPath(settingsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	} else if err == nil {
+		err = json.Unmarshal(content, &s)
+		if err != nil {
+			return s, fmt.Errorf("Invalid settings file '%s': %v", m.getPath(settingsFile), err)
+		}
+	}
+
+	// The settings file is shared through git, so its paths may not point
+	// outside of the notes directory, only the user's own settings may
+	for _, e := range s.Exports {
+		if err := m.checkInDir(e.File); err != nil {
+			return s, fmt.Errorf("Invalid export in '%s': %v", m.getPath(settingsFile), err)
+		}
+	}
+	if err := m.checkInDir(s.HTMLFile); err != nil {
+		return s, fmt.Errorf("Invalid html_file in '%s': %v", m.getPath(settingsFile), err)
+	}
+
+	u := m.UserSettings
+	s.Exports = append(s.Exports, u.Exports...)
+	if u.MarkdownExtensions != nil {
+		s.MarkdownExtensions = u.MarkdownExtensions
+	}
+	if u.AutoCommit != nil {
+		s.AutoCommit = u.AutoCommit
+	}
+	if u.HTMLFile != "" {
+		s.HTMLFile = u.HTMLFile
+	}
+	if s.HTMLFile == "" {
+		s.HTMLFile = defaultHTMLFile
+	}
+	if u.JournalFormat != "" {
+		s.JournalFormat = u.JournalFormat
+	}
+	if s.JournalFormat == "" {
+		s.JournalFormat = DefaultJournalFormat
+	}
+
+	for _, e := range s.Exports {
+		if e.File == "" {
+			return s, fmt.Errorf("Invalid settings file '%s': every export needs a file", m.getPath(settingsFile))
+		}
+		if _, err := ParseTagQuery(e.Tags); err != nil {
+			return s, fmt.Errorf("Invalid export '%s': %v", e.File, err)
+		}
+	}
+	return s, nil
+}
+
+// ExportPath returns where an export is written, relative paths are relative
+// to the notes directory
+func (m *Manager) ExportPath(e Export) string {
+	return m.settingsPath(e.File)
+}
+
+// HTMLPath returns where the html of every note is written
+func (m *Manager) HTMLPath(s Settings) string {
+	return m.settingsPath(s.HTMLFile)
+}
+
+// isOutside reports whether rel, a path relative to a directory, leaves it
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkInDir returns an error unless file is a relative path that stays in
+// Dir, even once any symlinks in it are followed
+func (m *Manager) checkInDir(file string) error {
+	if filepath.IsAbs(file) || isOutside(filepath.Clean(file)) {
+		return fmt.Errorf("'%s' must be a path inside the notes directory", file)
+	}
+
+	dir, err := filepath.EvalSymlinks(m.Dir)
+	if err != nil {
+		return err
+	}
+	// Only the part of the path that exists can be a symlink
+	path := filepath.Join(m.Dir, file)
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			rel, err := filepath.Rel(dir, resolved)
+			if err != nil || isOutside(rel) {
+				return fmt.Errorf("'%s' must be a path inside the notes directory, it resolves to '%s'", file, resolved)
+			}
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+func (m *Manager) settingsPath(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return m.getPath(file)
+}
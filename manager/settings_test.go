@@ -0,0 +1,75 @@
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSettingsExportPaths(t *testing.T) {
+	outside := t.TempDir()
+	for _, test := range []struct {
+		name string
+		file string
+		err  bool
+	}{
+		{"relative", "exports/work.html", false},
+		{"relative back into the notes directory", "exports/../work.html", false},
+		{"absolute", filepath.Join(outside, "work.html"), true},
+		{"parent directory", "../work.html", true},
+		{"nested parent directory", "exports/../../work.html", true},
+		{"symlink out of the notes directory", "link/work.html", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(t)
+			if err := os.Symlink(outside, filepath.Join(m.Dir, "link")); err != nil {
+				t.Fatal(err)
+			}
+			writeNote(t, m, settingsFile, `{"exports": [{"file": "`+test.file+`", "tags": "work"}]}`)
+			if _, err := m.LoadSettings(); (err != nil) != test.err {
+				t.Errorf("LoadSettings returned the error %v", err)
+			}
+		})
+	}
+
+	// The user's own settings may write anywhere
+	m := newTestManager(t)
+	file := filepath.Join(outside, "work.html")
+	m.UserSettings.Exports = []Export{{File: file, Tags: "work"}}
+	s, err := m.LoadSettings()
+	if err != nil || len(s.Exports) != 1 || m.ExportPath(s.Exports[0]) != file {
+		t.Errorf("LoadSettings returned %+v, %v", s, err)
+	}
+}
+
+func TestLoadSettingsHTMLFile(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "index.html")
+	for _, test := range []struct {
+		file string
+		err  bool
+	}{
+		{"", false},
+		{"site/index.html", false},
+		{outside, true},
+		{"../index.html", true},
+	} {
+		m := newTestManager(t)
+		writeNote(t, m, settingsFile, `{"html_file": "`+test.file+`"}`)
+		if _, err := m.LoadSettings(); (err != nil) != test.err {
+			t.Errorf("LoadSettings with the html file %q returned the error %v", test.file, err)
+		}
+	}
+
+	m := newTestManager(t)
+	writeNote(t, m, settingsFile, `{"html_file": "../index.html"}`)
+	m.UserSettings.HTMLFile = outside
+	if _, err := m.LoadSettings(); err == nil {
+		t.Errorf("The html file of the settings file should be checked even if the user's replaces it")
+	}
+	m = newTestManager(t)
+	m.UserSettings.HTMLFile = outside
+	s, err := m.LoadSettings()
+	if err != nil || m.HTMLPath(s) != outside {
+		t.Errorf("LoadSettings returned %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,256 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagQuery decides whether a note with the given tags should be included
+type TagQuery interface {
+	Matches(tags []string) bool
+}
+
+type anyQuery struct{}
+
+type tagQuery struct {
+	Tag string
+}
+
+type notQuery struct {
+	Query TagQuery
+}
+
+type andQuery struct {
+	Queries []TagQuery
+}
+
+type orQuery struct {
+	Queries []TagQuery
+}
+
+func (q anyQuery) Matches(tags []string) bool {
+	return true
+}
+
+func (q tagQuery) Matches(tags []string) bool {
+	for _, tag := range tags {
+		if strings.ToLower(tag) == q.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (q notQuery) Matches(tags []string) bool {
+	return !q.Query.Matches(tags)
+}
+
+func (q andQuery) Matches(tags []string) bool {
+	for _, sub := range q.Queries {
+		if !sub.Matches(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q orQuery) Matches(tags []string) bool {
+	for _, sub := range q.Queries {
+		if sub.Matches(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+type TagQueryError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *TagQueryError) Error() string {
+	return fmt.Sprintf("Invalid tag query '%s' at position %d: %s", e.Query, e.Pos+1, e.Msg)
+}
+
+type queryToken struct {
+	Text string
+	Pos  int
+}
+
+func isQuerySeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '(' || c == ')'
+}
+
+func lexTagQuery(query string) []queryToken {
+	tokens := []queryToken{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		if c == ' ' || c == '\t' {
+			i += 1
+		} else if c == '(' || c == ')' || ((c == '+' || c == '-') && (i == 0 || isQuerySeparator(query[i-1]))) {
+			tokens = append(tokens, queryToken{string(c), i})
+			i += 1
+		} else {
+			start := i
+			for i < len(query) && !isQuerySeparator(query[i]) {
+				i += 1
+			}
+			tokens = append(tokens, queryToken{query[start:i], start})
+		}
+	}
+	return tokens
+}
+
+type tagQueryParser struct {
+	query  string
+	tokens []queryToken
+	pos    int
+}
+
+func (p *tagQueryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].Text
+	}
+	return ""
+}
+
+func (p *tagQueryParser) errorf(format string, a ...interface{}) error {
+	pos := len(p.query)
+	if p.pos < len(p.tokens) {
+		pos = p.tokens[p.pos].Pos
+	}
+	return &TagQueryError{p.query, pos, fmt.Sprintf(format, a...)}
+}
+
+func (p *tagQueryParser) parseOr() (TagQuery, error) {
+	queries := []TagQuery{}
+	for {
+		q, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+		if p.peek() != "OR" {
+			break
+		}
+		p.pos += 1
+	}
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return orQuery{queries}, nil
+}
+
+// Tags next to each other without an operator are treated as an AND, so that
+// '+work +meeting -archived' requires both work and meeting
+func (p *tagQueryParser) parseAnd() (TagQuery, error) {
+	queries := []TagQuery{}
+	for {
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+
+		next := p.peek()
+		if next == "AND" {
+			p.pos += 1
+		} else if next == "" || next == "OR" || next == ")" {
+			break
+		}
+	}
+	if len(queries) == 1 {
+		return queries[0], nil
+	}
+	return andQuery{queries}, nil
+}
+
+func (p *tagQueryParser) parseUnary() (TagQuery, error) {
+	switch next := p.peek(); next {
+	case "":
+		return nil, p.errorf("expected a tag but the query ended")
+	case "NOT", "-":
+		p.pos += 1
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notQuery{q}, nil
+	case "+":
+		p.pos += 1
+		return p.parseUnary()
+	case "(":
+		p.pos += 1
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.errorf("expected ')'")
+		}
+		p.pos += 1
+		return q, nil
+	case ")", "AND", "OR":
+		return nil, p.errorf("expected a tag but found '%s'", next)
+	default:
+		p.pos += 1
+		tag := strings.TrimPrefix(next, "#")
+		if tag == "" {
+			p.pos -= 1
+			return nil, p.errorf("expected a tag name after '#'")
+		}
+		return tagQuery{strings.ToLower(tag)}, nil
+	}
+}
+
+// ParseTagQuery parses a query such as 'work AND (meeting OR call) AND NOT
+// archived' or '+work +meeting -archived'. Tags are matched case insensitively.
+func ParseTagQuery(query string) (TagQuery, error) {
+	p := &tagQueryParser{query, lexTagQuery(query), 0}
+	if len(p.tokens) == 0 {
+		return anyQuery{}, nil
+	}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected '%s'", p.peek())
+	}
+	return q, nil
+}
+
+// ParseTagQueries parses each query, a note matches if it matches any of them
+func ParseTagQueries(queries []string) (TagQuery, error) {
+	if len(queries) == 0 {
+		return anyQuery{}, nil
+	}
+	parsed := []TagQuery{}
+	for _, query := range queries {
+		q, err := ParseTagQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, q)
+	}
+	if len(parsed) == 1 {
+		return parsed[0], nil
+	}
+	return orQuery{parsed}, nil
+}
+
+// ValidateTag checks that a tag can be written to a header and found again by
+// a query
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("Tags may not be empty")
+	}
+	if strings.ContainsAny(tag, " \t,[]()#") {
+		return fmt.Errorf("Tag '%s' may not contain spaces, commas, brackets or '#'", tag)
+	}
+	if tag[0] == '+' || tag[0] == '-' || tag == "AND" || tag == "OR" || tag == "NOT" {
+		return fmt.Errorf("Tag '%s' would be read as a query operator", tag)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTagQuery(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  TagQuery
+	}{
+		{"", anyQuery{}},
+		{"  ", anyQuery{}},
+		{"Work", tagQuery{"work"}},
+		{"#work", tagQuery{"work"}},
+		{"work AND home", andQuery{[]TagQuery{tagQuery{"work"}, tagQuery{"home"}}}},
+		{"work home", andQuery{[]TagQuery{tagQuery{"work"}, tagQuery{"home"}}}},
+		{"work OR home", orQuery{[]TagQuery{tagQuery{"work"}, tagQuery{"home"}}}},
+		// NOT binds tighter than AND, which binds tighter than OR
+		{"NOT a AND b OR c", orQuery{[]TagQuery{
+			andQuery{[]TagQuery{notQuery{tagQuery{"a"}}, tagQuery{"b"}}},
+			tagQuery{"c"},
+		}}},
+		{"a OR b AND NOT c", orQuery{[]TagQuery{
+			tagQuery{"a"},
+			andQuery{[]TagQuery{tagQuery{"b"}, notQuery{tagQuery{"c"}}}},
+		}}},
+		{"a OR b c", orQuery{[]TagQuery{tagQuery{"a"}, andQuery{[]TagQuery{tagQuery{"b"}, tagQuery{"c"}}}}}},
+		{"(a OR b) AND c", andQuery{[]TagQuery{orQuery{[]TagQuery{tagQuery{"a"}, tagQuery{"b"}}}, tagQuery{"c"}}}},
+		{"NOT (a OR b)", notQuery{orQuery{[]TagQuery{tagQuery{"a"}, tagQuery{"b"}}}}},
+		{"((a))", tagQuery{"a"}},
+		{"+work +meeting -archived", andQuery{[]TagQuery{tagQuery{"work"}, tagQuery{"meeting"}, notQuery{tagQuery{"archived"}}}}},
+		{"-(a b)", notQuery{andQuery{[]TagQuery{tagQuery{"a"}, tagQuery{"b"}}}}},
+		// Only a leading + or - is an operator
+		{"k8s-prod c++", andQuery{[]TagQuery{tagQuery{"k8s-prod"}, tagQuery{"c++"}}}},
+		// Operators are case sensitive, anything else is a tag
+		{"a and b", andQuery{[]TagQuery{tagQuery{"a"}, tagQuery{"and"}, tagQuery{"b"}}}},
+	} {
+		got, err := ParseTagQuery(test.query)
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseTagQuery(%q) = %#v, %v, want %#v", test.query, got, err, test.want)
+		}
+	}
+}
+
+func TestTagQueryMatches(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		tags  []string
+		want  bool
+	}{
+		{"", []string{}, true},
+		{"work", []string{"Work"}, true},
+		{"WORK", []string{"work"}, true},
+		{"work", []string{"home"}, false},
+		{"work home", []string{"work"}, false},
+		{"work home", []string{"home", "work"}, true},
+		{"work OR home", []string{"home"}, true},
+		{"NOT work", []string{}, true},
+		{"NOT work", []string{"work"}, false},
+		{"NOT a AND b OR c", []string{"c", "a"}, true},
+		{"NOT a AND b OR c", []string{"a", "b"}, false},
+		{"NOT (a OR b)", []string{"b"}, false},
+		{"+work -archived", []string{"work"}, true},
+		{"+work -archived", []string{"work", "archived"}, false},
+	} {
+		q, err := ParseTagQuery(test.query)
+		if err != nil {
+			t.Fatalf("ParseTagQuery(%q): %v", test.query, err)
+		}
+		if got := q.Matches(test.tags); got != test.want {
+			t.Errorf("%q matching %v = %v, want %v", test.query, test.tags, got, test.want)
+		}
+	}
+}
+
+func TestParseTagQueryErrors(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		pos   int
+	}{
+		{"work AND", 8},
+		{"work OR", 7},
+		{"NOT", 3},
+		{"-", 1},
+		{"AND work", 0},
+		{"work OR OR home", 8},
+		{"(work", 5},
+		{"(work home", 10},
+		{"work )", 5},
+		{"()", 1},
+		{"#", 0},
+		{"work AND #", 9},
+	} {
+		_, err := ParseTagQuery(test.query)
+		queryErr, ok := err.(*TagQueryError)
+		if !ok {
+			t.Errorf("ParseTagQuery(%q) returned %v, want a TagQueryError", test.query, err)
+		} else if queryErr.Query != test.query || queryErr.Pos != test.pos {
+			t.Errorf("ParseTagQuery(%q) failed at %d, want %d: %v", test.query, queryErr.Pos, test.pos, err)
+		}
+	}
+}
+
+func TestParseTagQueries(t *testing.T) {
+	q, err := ParseTagQueries([]string{"a b", "c"})
+	want := orQuery{[]TagQuery{andQuery{[]TagQuery{tagQuery{"a"}, tagQuery{"b"}}}, tagQuery{"c"}}}
+	if err != nil || !reflect.DeepEqual(q, want) {
+		t.Errorf("ParseTagQueries returned %#v, %v", q, err)
+	}
+	if _, err := ParseTagQueries([]string{"a", "b OR"}); err == nil {
+		t.Errorf("An invalid query should be an error")
+	}
+}
+
+func TestValidateTag(t *testing.T) {
+	for _, test := range []struct {
+		tag   string
+		valid bool
+	}{
+		{"work", true},
+		{"k8s-prod", true},
+		{"c++", true},
+		{"and", true},
+		{"", false},
+		{"two words", false},
+		{"a,b", false},
+		{"[a]", false},
+		{"(a)", false},
+		{"#a", false},
+		{"+a", false},
+		{"-a", false},
+		{"AND", false},
+		{"OR", false},
+		{"NOT", false},
+	} {
+		if err := ValidateTag(test.tag); (err == nil) != test.valid {
+			t.Errorf("ValidateTag(%q) returned %v", test.tag, err)
+		}
+	}
+}
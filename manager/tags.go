@@ -0,0 +1,226 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TagCount is the number of notes with a tag, tags that only differ in case
+// are counted as one
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// CountTags counts the notes with each tag, most used first, tags are
+// lowercased as they are in tag queries
+func CountTags(notes []Note) []TagCount {
+	counts := make(map[string]int)
+	for _, note := range notes {
+		seen := make(map[string]bool)
+		for _, tag := range note.Tags {
+			tag = strings.ToLower(tag)
+			if !seen[tag] {
+				seen[tag] = true
+				counts[tag] += 1
+			}
+		}
+	}
+	tags := []TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, TagCount{tag, count})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if tags[i].Count == tags[j].Count {
+			return tags[i].Tag < tags[j].Tag
+		}
+		return tags[i].Count > tags[j].Count
+	})
+	return tags
+}
+
+// TagChange is the header of a note before and after its tags were renamed
+type TagChange struct {
+	Note      Note
+	OldHeader string
+	NewHeader string
+}
+
+// renameBracketTags renames the tags in a '[@id, #tag]' line, keeping the
+// rest of the line as it was written. Only the first occurrence of newTag is
+// kept, so merging tags does not repeat it.
+func renameBracketTags(line string, isOld func(tag string) bool, newTag string) string {
+	start := strings.Index(line, "[")
+	end := strings.LastIndex(line, "]")
+	kept := []string{}
+	seenNew := false
+	for _, item := range strings.Split(line[start+1:end], ",") {
+		trimmed := strings.TrimSpace(item)
+		if strings.HasPrefix(trimmed, "#") {
+			tag := trimmed[1:]
+			if isOld(tag) {
+				item = strings.Replace(item, trimmed, "#"+newTag, 1)
+				tag = newTag
+			}
+			if strings.EqualFold(tag, newTag) {
+				if seenNew {
+					continue
+				}
+				seenNew = true
+			}
+		}
+		kept = append(kept, item)
+	}
+	return line[:start+1] + strings.Join(kept, ",") + line[end:]
+}
+
+// isEntryContinuation reports whether a line of front matter continues the
+// entry above it, as the items of a block list and indented lines do
+func isEntryContinuation(line string) bool {
+	trimmed := strings.TrimRight(line, "\r\n")
+	return strings.HasPrefix(trimmed, " ") || strings.HasPrefix(trimmed, "\t") ||
+		strings.HasPrefix(trimmed, "- ") || trimmed == "-"
+}
+
+// renameFrontMatterTags replaces the tags entry of a front matter header with
+// tags, keeping every other line as it was written. The entry keeps its
+// style, an inline list stays inline and a block list keeps its indent.
+func renameFrontMatterTags(header string, tags []string) (string, error) {
+	lines := strings.SplitAfter(header, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "tags:") {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return "", fmt.Errorf("Could not find the tags in the front matter")
+	}
+	end := start + 1
+	for end < len(lines) && isEntryContinuation(lines[end]) {
+		end += 1
+	}
+
+	value := strings.TrimSpace(strings.TrimPrefix(lines[start], "tags:"))
+	var out []byte
+	var err error
+	if value == "" && end > start+1 && len(tags) > 0 {
+		out, err = yaml.Marshal(yaml.MapSlice{{Key: "tags", Value: tags}})
+		// The items keep the indent of the first one
+		first := lines[start+1]
+		indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+		out = []byte(strings.Replace(string(out), "\n-", "\n"+indent+"-", -1))
+	} else if !strings.HasPrefix(value, "[") && len(tags) == 1 {
+		out, err = yaml.Marshal(yaml.MapSlice{{Key: "tags", Value: tags[0]}})
+	} else {
+		out, err = yaml.Marshal(struct {
+			Tags []string `yaml:"tags,flow"`
+		}{tags})
+	}
+	if err != nil {
+		return "", err
+	}
+	entry := string(out)
+	if strings.HasSuffix(lines[start], "\r\n") {
+		entry = strings.Replace(entry, "\n", "\r\n", -1)
+	}
+
+	newHeader := strings.Join(lines[:start], "") + entry + strings.Join(lines[end:], "")
+	h, _, err := parseHeader(newHeader)
+	if err != nil || !reflect.DeepEqual(append([]string{}, h.Tags...), append([]string{}, tags...)) {
+		return "", fmt.Errorf("Could not rewrite the tags in the front matter")
+	}
+	return newHeader, nil
+}
+
+// renameHeaderTags returns the header with the tags renamed, only the tags
+// are rewritten and the rest of the header keeps its layout
+func renameHeaderTags(h Header, header string, isOld func(tag string) bool, newTag string) (string, error) {
+	if h.Format == BracketHeader {
+		line := strings.TrimRight(header, "\r\n")
+		return renameBracketTags(line, isOld, newTag) + header[len(line):], nil
+	}
+
+	tags := []string{}
+	seenNew := false
+	for _, tag := range h.Tags {
+		if isOld(tag) {
+			tag = newTag
+		}
+		if strings.EqualFold(tag, newTag) {
+			if seenNew {
+				continue
+			}
+			seenNew = true
+		}
+		tags = append(tags, tag)
+	}
+	if reflect.DeepEqual(tags, h.Tags) {
+		return header, nil
+	}
+	return renameFrontMatterTags(header, tags)
+}
+
+// RenameTags replaces every tag in oldTags with newTag in the notes of the
+// notebook, ignoring case, so that a note with several of the tags is left
+// with newTag once. Only the header of each note is rewritten, the rest is
+// kept byte for byte. If dryRun is set the changes are returned without being
+// written.
+func (m *Manager) RenameTags(oldTags []string, newTag string, dryRun bool) ([]TagChange, error) {
+	unlock, err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	isOld := func(tag string) bool {
+		for _, old := range oldTags {
+			if strings.EqualFold(tag, old) {
+				return true
+			}
+		}
+		return false
+	}
+
+	changes := []TagChange{}
+	notes, err := m.ListNotes(nil)
+	if err != nil {
+		return changes, err
+	}
+	for _, note := range notes {
+		content, err := ioutil.ReadFile(note.Path)
+		if err != nil {
+			return changes, err
+		}
+		h, body, err := parseHeader(string(content))
+		header := string(content[:len(content)-len(body)])
+		// A header that cannot be parsed has no tags to rename
+		if h.Format == NoHeader || err != nil {
+			continue
+		}
+
+		newHeader, err := renameHeaderTags(h, header, isOld, newTag)
+		if err != nil {
+			return changes, fmt.Errorf("%s: %v", m.NoteName(note), err)
+		}
+		if newHeader == header {
+			continue
+		}
+		changes = append(changes, TagChange{note, header, newHeader})
+		if dryRun {
+			continue
+		}
+		m.markChangedPath(note.Path)
+		err = ioutil.WriteFile(note.Path, []byte(newHeader+body), 0644)
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,120 @@
+package manager
+
+import "testing"
+
+func TestRenameTags(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		oldTags []string
+		newTag  string
+		content string
+		want    string
+	}{
+		{
+			"bracket header",
+			[]string{"k8s"}, "kubernetes",
+			"[@3,  #work, #K8s] \nbody #k8s\n",
+			"[@3,  #work, #kubernetes] \nbody #k8s\n",
+		},
+		{
+			"bracket header with case variants",
+			[]string{"work", "job"}, "work",
+			"[@3, #Work, #work, #job, draft]\n",
+			"[@3, #work, draft]\n",
+		},
+		{
+			"bracket header that has the new tag",
+			[]string{"job"}, "work",
+			"[@3, #WORK, #job]\n",
+			"[@3, #WORK]\n",
+		},
+		{
+			"inline front matter",
+			[]string{"k8s"}, "kubernetes",
+			"---\nid: 4   # the id\ntags: [work, k8s]\ncreated: 2026-10-17 09:30\nstatus: active\n---\nbody\n",
+			"---\nid: 4   # the id\ntags: [work, kubernetes]\ncreated: 2026-10-17 09:30\nstatus: active\n---\nbody\n",
+		},
+		{
+			"block list front matter",
+			[]string{"k8s"}, "kubernetes",
+			"---\ntitle: 'Plan'\ntags:\n  - work\n  - k8s\nsource: x\n---\n",
+			"---\ntitle: 'Plan'\ntags:\n  - work\n  - kubernetes\nsource: x\n---\n",
+		},
+		{
+			"unindented block list front matter",
+			[]string{"k8s"}, "kubernetes",
+			"---\ntags:\n- k8s\n- work\n---\n",
+			"---\ntags:\n- kubernetes\n- work\n---\n",
+		},
+		{
+			"front matter with a tag string",
+			[]string{"k8s"}, "kubernetes",
+			"---\nid: 1\ntags: k8s\n---\n",
+			"---\nid: 1\ntags: kubernetes\n---\n",
+		},
+		{
+			"front matter with case variants",
+			[]string{"work", "job"}, "work",
+			"---\ntags:\n  - Work\n  - job\n  - home\n  - WORK\nid: 2\n---\n",
+			"---\ntags:\n  - work\n  - home\nid: 2\n---\n",
+		},
+		{
+			"front matter with windows line endings",
+			[]string{"k8s"}, "kubernetes",
+			"---\r\nid: 1\r\ntags: [k8s]\r\n---\r\nbody\r\n",
+			"---\r\nid: 1\r\ntags: [kubernetes]\r\n---\r\nbody\r\n",
+		},
+		{
+			"front matter without the tag",
+			[]string{"k8s"}, "kubernetes",
+			"---\ntags: [ work ]\n---\n",
+			"---\ntags: [ work ]\n---\n",
+		},
+		{
+			"no header",
+			[]string{"k8s"}, "kubernetes",
+			"body #k8s\n",
+			"body #k8s\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(t)
+			writeNote(t, m, "Note.md", test.content)
+
+			if _, err := m.RenameTags(test.oldTags, test.newTag, true); err != nil {
+				t.Fatal(err)
+			}
+			if content := readNote(t, m, "Note.md"); content != test.content {
+				t.Errorf("A dry run changed the note to %q", content)
+			}
+
+			changes, err := m.RenameTags(test.oldTags, test.newTag, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if content := readNote(t, m, "Note.md"); content != test.want {
+				t.Errorf("The note is\n%q\nwant\n%q", content, test.want)
+			}
+			if changed := test.content != test.want; changed != (len(changes) == 1) {
+				t.Errorf("RenameTags returned the changes %+v", changes)
+			}
+		})
+	}
+}
+
+func TestCountTags(t *testing.T) {
+	counts := CountTags([]Note{
+		{Tags: []string{"Work", "work", "home"}},
+		{Tags: []string{"WORK"}},
+		{Tags: []string{"a"}},
+	})
+	want := []TagCount{{"work", 2}, {"a", 1}, {"home", 1}}
+	if len(counts) != len(want) {
+		t.Fatalf("CountTags returned %v", counts)
+	}
+	for i := range want {
+		if counts[i] != want[i] {
+			t.Errorf("CountTags returned %v, want %v", counts, want)
+		}
+	}
+}
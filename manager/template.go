@@ -0,0 +1,97 @@
+package manager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const templatesDir = "templates"
+
+var placeholderPattern = regexp.MustCompile(`{{\s*([a-z]+)\s*}}`)
+
+// expandPlaceholders replaces {{key}} with the value for key, placeholders
+// without a value are left as they are
+func expandPlaceholders(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		key := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[key]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// mergeTags appends the tags in b that are not already in a, ignoring case
+func mergeTags(a []string, b []string) []string {
+	merged := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range append(append([]string{}, a...), b...) {
+		if !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// ValidateTemplate checks that a template name refers to a file directly in
+// the templates directory, so it cannot be used to read other files
+func ValidateTemplate(template string) error {
+	if strings.ContainsAny(template, "/\\") || strings.Contains(template, "..") {
+		return fmt.Errorf("Template '%s' may not contain slashes or '..'", template)
+	}
+	return nil
+}
+
+// NoteContent returns the content for a new note with the given id, title and
+// tags. If template is not empty the note is created from templates/<name>.md,
+// which may use the placeholders {{date}}, {{title}}, {{id}} and {{tags}} and
+// may have a header with default tags.
+func (m *Manager) NoteContent(template string, id int, title string, tags []string) (string, error) {
+	h := Header{Format: BracketHeader, Id: id, Tags: []string{}}
+	body := ""
+
+	if template != "" {
+		if err := ValidateTemplate(template); err != nil {
+			return "", err
+		}
+		content, err := ioutil.ReadFile(m.getPath(templatesDir + "/" + template + ".md"))
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("No template called '%s' in %s", template, m.getPath(templatesDir))
+		} else if err != nil {
+			return "", err
+		}
+
+		th, _, err := parseHeader(string(content))
+		if err != nil {
+			return "", fmt.Errorf("Template '%s': %v", template, err)
+		}
+		values := map[string]string{
+			"date":  time.Now().Format(dateFormat),
+			"title": title,
+			"id":    strconv.Itoa(id),
+			"tags":  strings.Join(mergeTags(th.Tags, tags), ", "),
+		}
+
+		h, body, err = parseHeader(expandPlaceholders(string(content), values))
+		if err != nil {
+			return "", fmt.Errorf("Template '%s': %v", template, err)
+		}
+		if h.Format == NoHeader {
+			h.Format = BracketHeader
+		}
+		h.Id = id
+	}
+	h.Tags = mergeTags(h.Tags, tags)
+
+	header, err := h.Render(h.Format)
+	if err != nil {
+		return "", err
+	}
+	return header + body, nil
+}
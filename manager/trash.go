@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	trashDir       = ".trash"
+	trashInfoFile  = "info.json"
+	trashDirFormat = "20060102-150405.000000000"
+)
+
+// TrashedNote is a deleted note along with the attachments that were deleted
+// with it, kept in its own directory under .trash. Title includes the notebook
+// of the note, and Files are relative to the notes directory.
+type TrashedNote struct {
+	Title   string
+	Files   []string
+	Deleted time.Time
+	Dir     string `json:"-"`
+}
+
+func (m *Manager) trashPath(name string) string {
+	return m.getPath(trashDir + "/" + name)
+}
+
+// Delete moves the note called name and its attachments to the trash
+func (m *Manager) Delete(name string) error {
+	fileName := m.getFileName(name, "md", 0)
+	_, err := os.Stat(m.getPath(fileName))
+	if err != nil {
+		return err
+	}
+	attachments, err := m.attachments(name)
+	if err != nil {
+		return err
+	}
+
+	deleted := time.Now()
+	t := TrashedNote{m.inNotebook(name), append([]string{fileName}, attachments...), deleted, deleted.Format(trashDirFormat)}
+	m.markChanged(trashDir + "/" + t.Dir)
+	err = os.MkdirAll(m.trashPath(t.Dir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	info, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(m.trashPath(t.Dir+"/"+trashInfoFile), info, 0644)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range t.Files {
+		err = os.MkdirAll(filepath.Dir(m.trashPath(t.Dir+"/"+f)), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		m.markChanged(f)
+		err = os.Rename(m.getPath(f), m.trashPath(t.Dir+"/"+f))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListTrash returns the trashed notes, most recently deleted first
+func (m *Manager) ListTrash() ([]TrashedNote, error) {
+	trashed := []TrashedNote{}
+	dirs, err := ioutil.ReadDir(m.trashPath(""))
+	if os.IsNotExist(err) {
+		return trashed, nil
+	} else if err != nil {
+		return trashed, err
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(m.trashPath(d.Name() + "/" + trashInfoFile))
+		if err != nil {
+			return trashed, err
+		}
+		var t TrashedNote
+		err = json.Unmarshal(content, &t)
+		if err != nil {
+			return trashed, fmt.Errorf("Invalid trash entry '%s': %v", d.Name(), err)
+		}
+		t.Dir = d.Name()
+		trashed = append(trashed, t)
+	}
+
+	sort.SliceStable(trashed, func(i, j int) bool {
+		return trashed[i].Deleted.After(trashed[j].Deleted)
+	})
+	return trashed, nil
+}
+
+// Restore moves the most recently deleted note called name, and its
+// attachments, back into the notes directory
+func (m *Manager) Restore(name string) error {
+	trashed, err := m.ListTrash()
+	if err != nil {
+		return err
+	}
+
+	for _, t := range trashed {
+		if t.Title != m.inNotebook(name) {
+			continue
+		}
+
+		// Restoring under a different name would break the links between
+		// the note and its attachments
+		for _, f := range t.Files {
+			if _, err := os.Stat(m.getPath(f)); err == nil {
+				return fmt.Errorf("'%s' already exists, rename it before restoring '%s'", f, name)
+			}
+		}
+		m.markChanged(trashDir + "/" + t.Dir)
+		for _, f := range t.Files {
+			m.markChanged(f)
+			err = os.MkdirAll(filepath.Dir(m.getPath(f)), os.ModePerm)
+			if err != nil {
+				return err
+			}
+			err = os.Rename(m.trashPath(t.Dir+"/"+f), m.getPath(f))
+			if err != nil {
+				return err
+			}
+		}
+		return os.RemoveAll(m.trashPath(t.Dir))
+	}
+
+	return fmt.Errorf("No note called '%s' in the trash", name)
+}
+
+// EmptyTrash permanently deletes the notes that were trashed more than
+// olderThan ago, returning the notes that were deleted
+func (m *Manager) EmptyTrash(olderThan time.Duration) ([]TrashedNote, error) {
+	emptied := []TrashedNote{}
+	trashed, err := m.ListTrash()
+	if err != nil {
+		return emptied, err
+	}
+
+	for _, t := range trashed {
+		if time.Since(t.Deleted) < olderThan {
+			continue
+		}
+		m.markChanged(trashDir + "/" + t.Dir)
+		err = os.RemoveAll(m.trashPath(t.Dir))
+		if err != nil {
+			return emptied, err
+		}
+		emptied = append(emptied, t)
+	}
+	return emptied, nil
+}
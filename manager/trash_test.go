@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func trashedTitles(t *testing.T, m *Manager) []string {
+	t.Helper()
+	trashed, err := m.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := []string{}
+	for _, note := range trashed {
+		titles = append(titles, note.Title)
+	}
+	return titles
+}
+
+// ageTrash makes the trashed note look like it was deleted age ago
+func ageTrash(t *testing.T, m *Manager, note TrashedNote, age time.Duration) {
+	t.Helper()
+	note.Deleted = time.Now().Add(-age)
+	info, err := json.Marshal(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(m.trashPath(note.Dir+"/"+trashInfoFile), info, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(m *Manager, name string) bool {
+	_, err := os.Stat(filepath.Join(m.Dir, name))
+	return err == nil
+}
+
+func TestDeleteAndRestore(t *testing.T) {
+	m := newTestManager(t)
+	writeNote(t, m, "work/Plan.md", "[@1]\n")
+	writeNote(t, m, "work/Plan.png", "image")
+
+	if err := m.Delete("work/Plan"); err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := m.ListTrash()
+	if err != nil || len(trashed) != 1 {
+		t.Fatalf("ListTrash returned %+v, %v", trashed, err)
+	}
+	if trashed[0].Title != "work/Plan" || !reflect.DeepEqual(trashed[0].Files, []string{"work/Plan.md", "work/Plan.png"}) {
+		t.Errorf("The trashed note is %+v", trashed[0])
+	}
+	if exists(m, "work/Plan.md") || exists(m, "work/Plan.png") {
+		t.Errorf("The note was left in place")
+	}
+	if notes, _ := m.ListNotes(nil); len(notes) != 0 {
+		t.Errorf("Trashed notes should not be listed, got %+v", notes)
+	}
+
+	if err := m.Restore("work/Plan"); err != nil {
+		t.Fatal(err)
+	}
+	if readNote(t, m, "work/Plan.md") != "[@1]\n" || readNote(t, m, "work/Plan.png") != "image" {
+		t.Errorf("The note and its attachment were not restored")
+	}
+	if titles := trashedTitles(t, m); len(titles) != 0 {
+		t.Errorf("The trash still holds %v", titles)
+	}
+	if err := m.Restore("work/Plan"); err == nil {
+		t.Errorf("Restoring a note that is not in the trash should fail")
+	}
+}
+
+func TestRestoreCollisions(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		existing string
+	}{
+		{"note", "Plan.md"},
+		{"attachment", "Plan.png"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newTestManager(t)
+			writeNote(t, m, "Plan.md", "[@1]\nold\n")
+			writeNote(t, m, "Plan.png", "old image")
+			if err := m.Delete("Plan"); err != nil {
+				t.Fatal(err)
+			}
+			writeNote(t, m, test.existing, "new")
+
+			if err := m.Restore("Plan"); err == nil {
+				t.Fatalf("Restoring over %s should fail", test.existing)
+			}
+			// Nothing is moved out of the trash or overwritten
+			if content := readNote(t, m, test.existing); content != "new" {
+				t.Errorf("%s was overwritten with %q", test.existing, content)
+			}
+			trashed, err := m.ListTrash()
+			if err != nil || len(trashed) != 1 {
+				t.Fatalf("ListTrash returned %+v, %v", trashed, err)
+			}
+			for _, f := range trashed[0].Files {
+				if _, err := os.Stat(m.trashPath(trashed[0].Dir + "/" + f)); err != nil {
+					t.Errorf("%s is no longer in the trash: %v", f, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoreMostRecent(t *testing.T) {
+	m := newTestManager(t)
+	for _, content := range []string{"[@1]\nfirst\n", "[@2]\nsecond\n"} {
+		writeNote(t, m, "Plan.md", content)
+		if err := m.Delete("Plan"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Restore("Plan"); err != nil {
+		t.Fatal(err)
+	}
+	if content := readNote(t, m, "Plan.md"); content != "[@2]\nsecond\n" {
+		t.Errorf("Restored %q rather than the most recently deleted note", content)
+	}
+	if titles := trashedTitles(t, m); !reflect.DeepEqual(titles, []string{"Plan"}) {
+		t.Errorf("The trash holds %v", titles)
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	m := newTestManager(t)
+	for _, name := range []string{"Old", "Recent"} {
+		writeNote(t, m, name+".md", "")
+		writeNote(t, m, name+".png", "")
+		if err := m.Delete(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trashed, err := m.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, note := range trashed {
+		if note.Title == "Old" {
+			ageTrash(t, m, note, 48*time.Hour)
+		}
+	}
+
+	emptied, err := m.EmptyTrash(24 * time.Hour)
+	if err != nil || len(emptied) != 1 || emptied[0].Title != "Old" {
+		t.Fatalf("EmptyTrash returned %+v, %v", emptied, err)
+	}
+	if titles := trashedTitles(t, m); !reflect.DeepEqual(titles, []string{"Recent"}) {
+		t.Errorf("The trash holds %v", titles)
+	}
+
+	emptied, err = m.EmptyTrash(0)
+	if err != nil || len(emptied) != 1 || emptied[0].Title != "Recent" {
+		t.Fatalf("EmptyTrash returned %+v, %v", emptied, err)
+	}
+	if dirs, err := ioutil.ReadDir(m.trashPath("")); err != nil || len(dirs) != 0 {
+		t.Errorf("The trash holds %v, %v", dirs, err)
+	}
+
+	// An empty or missing trash is not an error
+	if emptied, err := newTestManager(t).EmptyTrash(0); err != nil || len(emptied) != 0 {
+		t.Errorf("EmptyTrash returned %+v, %v", emptied, err)
+	}
+}
@@ -0,0 +1,36 @@
+package request
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DurationFlag is a duration that, unlike time.Duration, may also be given in
+// days or weeks, such as 30d or 2w
+type DurationFlag time.Duration
+
+func (d *DurationFlag) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *DurationFlag) Set(value string) error {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil {
+				return err
+			}
+			*d = DurationFlag(time.Duration(n) * unit)
+			return nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = DurationFlag(duration)
+	return nil
+}
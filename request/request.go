@@ -4,10 +4,13 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
 )
 
 type Cmd int
 
+const tagsUsage = "a tag query such as 'work AND NOT archived' or '+work -archived', may be repeated to match any of the queries"
+
 const (
 	NEW Cmd = iota
 	MV
@@ -19,11 +22,28 @@ const (
 	GIT
 	PUSH
 	INIT_REPO
+	FSCK
+	SEARCH
+	MIGRATE_HEADER
+	RENAME
+	LINKS
+	TRASH
+	TODAY
+	JOURNAL
+	SERVE
+	API
+	SYNC
+	HISTORY
+	DIFF
+	RESTORE
+	LIST
+	TAGS
 )
 
 type NewArgs struct {
-	Title string
-	Tags  ArrayFlags
+	Title    string
+	Tags     ArrayFlags
+	Template string
 }
 
 type MvArgs struct {
@@ -44,6 +64,19 @@ type ConcatArgs struct {
 	Tags ArrayFlags
 }
 
+type ListArgs struct {
+	Tags   ArrayFlags
+	Sort   string
+	Format string
+}
+
+type TagsArgs struct {
+	Action string
+	Names  []string
+	Into   string
+	DryRun bool
+}
+
 type FindArgs struct {
 	Tags ArrayFlags
 }
@@ -51,23 +84,96 @@ type FindArgs struct {
 type HtmlArgs struct {
 	Tags ArrayFlags
 	File string
+	Site string
+}
+
+type FsckArgs struct {
+	DryRun bool
+}
+
+type SearchArgs struct {
+	Tags  ArrayFlags
+	Query string
+}
+
+type MigrateHeaderArgs struct {
+	Tags   ArrayFlags
+	To     string
+	DryRun bool
+}
+
+type RenameArgs struct {
+	Title    string
+	NewTitle string
+}
+
+type LinksArgs struct {
+	Title string
+}
+
+type TrashArgs struct {
+	Action    string
+	Title     string
+	OlderThan DurationFlag
+	Force     bool
+}
+
+type JournalArgs struct {
+	Date   string
+	Format string
+	Week   bool
+}
+
+type InitRepoArgs struct {
+	Origin string
+}
+
+type SyncArgs struct {
+	Merge bool
+}
+
+type HistoryArgs struct {
+	Title string
+	Rev   string
+}
+
+type ServeArgs struct {
+	Addr string
 }
 
 type Request struct {
 	Cmd        Cmd
 	Args       []string
 	NotesDir   string
+	Profile    string
+	Notebook   string
 	NewArgs    *NewArgs
 	MvArgs     *MvArgs
 	EditArgs   *EditArgs
 	DeleteArgs *DeleteArgs
 	ConcatArgs *ConcatArgs
+	ListArgs   *ListArgs
+	TagsArgs   *TagsArgs
 	FindArgs   *FindArgs
 	HtmlArgs   *HtmlArgs
+	FsckArgs   *FsckArgs
+	SearchArgs *SearchArgs
+
+	MigrateHeaderArgs *MigrateHeaderArgs
+	RenameArgs        *RenameArgs
+	LinksArgs         *LinksArgs
+	TrashArgs         *TrashArgs
+	JournalArgs       *JournalArgs
+	ServeArgs         *ServeArgs
+	InitRepoArgs      *InitRepoArgs
+	SyncArgs          *SyncArgs
+	HistoryArgs       *HistoryArgs
 }
 
 func bindSharedArgs(fs *flag.FlagSet, r *Request) {
-	fs.StringVar(&r.NotesDir, "path", "", "path to notes directory")
+	fs.StringVar(&r.NotesDir, "path", "", "path to notes directory, overrides the notes dir of the profile")
+	fs.StringVar(&r.Profile, "profile", "", "the profile in the config file to use, the default profile if not set")
+	fs.StringVar(&r.Notebook, "notebook", "", "only use the notes in this directory of the notes directory, such as projects/foo")
 }
 
 func bindCommandArgs(fs *flag.FlagSet, r *Request, title string) {
@@ -75,6 +181,7 @@ func bindCommandArgs(fs *flag.FlagSet, r *Request, title string) {
 		r.NewArgs = &NewArgs{}
 		r.NewArgs.Title = title
 		fs.Var(&r.NewArgs.Tags, "tags", "the tags for the note")
+		fs.StringVar(&r.NewArgs.Template, "template", "", "the template in the templates folder to create the note from")
 	} else if r.Cmd == MV {
 		r.MvArgs = &MvArgs{}
 		r.MvArgs.Title = title
@@ -82,20 +189,77 @@ func bindCommandArgs(fs *flag.FlagSet, r *Request, title string) {
 	} else if r.Cmd == EDIT {
 		r.EditArgs = &EditArgs{}
 		fs.StringVar(&r.EditArgs.Title, "title", "", "the title of the note")
-		fs.Var(&r.EditArgs.Tags, "tags", "the tags for the note")
+		fs.Var(&r.EditArgs.Tags, "tags", tagsUsage)
 	} else if r.Cmd == CONCAT {
 		r.ConcatArgs = &ConcatArgs{}
-		fs.Var(&r.ConcatArgs.Tags, "tags", "the tags for the note")
+		fs.Var(&r.ConcatArgs.Tags, "tags", tagsUsage)
 	} else if r.Cmd == DELETE {
 		r.DeleteArgs = &DeleteArgs{}
 		r.DeleteArgs.Title = title
+	} else if r.Cmd == LIST {
+		r.ListArgs = &ListArgs{}
+		fs.Var(&r.ListArgs.Tags, "tags", tagsUsage)
+		fs.StringVar(&r.ListArgs.Sort, "sort", "id", "the order of the notes, one of 'id', 'mtime' or 'title'")
+		fs.StringVar(&r.ListArgs.Format, "format", "table", "the output format, one of 'table', 'json', 'csv' or 'paths'")
+	} else if r.Cmd == TAGS {
+		r.TagsArgs = &TagsArgs{}
+		fs.StringVar(&r.TagsArgs.Into, "into", "", "the tag to merge the tags into")
+		fs.BoolVar(&r.TagsArgs.DryRun, "dry-run", false, "show the changes to the headers as a diff instead of making them")
 	} else if r.Cmd == FIND {
 		r.FindArgs = &FindArgs{}
-		fs.Var(&r.FindArgs.Tags, "tags", "the tags for the note")
+		fs.Var(&r.FindArgs.Tags, "tags", tagsUsage)
 	} else if r.Cmd == HTML {
 		r.HtmlArgs = &HtmlArgs{}
-		fs.Var(&r.HtmlArgs.Tags, "tags", "the tags for the note")
-		fs.StringVar(&r.HtmlArgs.File, "file", "", "the file to store the html output")
+		fs.Var(&r.HtmlArgs.Tags, "tags", tagsUsage)
+		fs.StringVar(&r.HtmlArgs.File, "file", "", "the file to store the html output, required with --tags")
+		fs.StringVar(&r.HtmlArgs.Site, "site", "", "write a page per note and per tag to this directory instead of a single file")
+	} else if r.Cmd == FSCK {
+		r.FsckArgs = &FsckArgs{}
+		fs.BoolVar(&r.FsckArgs.DryRun, "dry-run", false, "only report problems, do not fix them")
+	} else if r.Cmd == SEARCH {
+		r.SearchArgs = &SearchArgs{}
+		fs.Var(&r.SearchArgs.Tags, "tags", tagsUsage)
+	} else if r.Cmd == MIGRATE_HEADER {
+		r.MigrateHeaderArgs = &MigrateHeaderArgs{}
+		fs.Var(&r.MigrateHeaderArgs.Tags, "tags", tagsUsage)
+		fs.StringVar(&r.MigrateHeaderArgs.To, "to", "", "the header format to convert to, either 'bracket' or 'front-matter'")
+		fs.BoolVar(&r.MigrateHeaderArgs.DryRun, "dry-run", false, "only report the notes that would change")
+	} else if r.Cmd == RENAME {
+		r.RenameArgs = &RenameArgs{}
+		r.RenameArgs.Title = title
+	} else if r.Cmd == LINKS {
+		r.LinksArgs = &LinksArgs{}
+	} else if r.Cmd == TRASH {
+		r.TrashArgs = &TrashArgs{}
+		fs.Var(&r.TrashArgs.OlderThan, "older-than", "only empty notes deleted longer ago than this, such as 30d")
+		fs.BoolVar(&r.TrashArgs.Force, "force", false, "empty the whole trash without asking first")
+	} else if r.Cmd == TODAY || r.Cmd == JOURNAL {
+		r.JournalArgs = &JournalArgs{}
+		fs.StringVar(&r.JournalArgs.Format, "format", "", "the layout of journal titles as a Go time layout, the journal_format setting by default")
+		fs.BoolVar(&r.JournalArgs.Week, "week", false, "view every entry from the week instead of editing one")
+		if r.Cmd == JOURNAL {
+			fs.StringVar(&r.JournalArgs.Date, "date", "", "the date of the entry, as YYYY-MM-DD")
+		}
+	} else if r.Cmd == INIT_REPO {
+		r.InitRepoArgs = &InitRepoArgs{}
+	} else if r.Cmd == HISTORY || r.Cmd == DIFF || r.Cmd == RESTORE {
+		r.HistoryArgs = &HistoryArgs{}
+		if r.Cmd == RESTORE {
+			fs.StringVar(&r.HistoryArgs.Rev, "rev", "", "the commit to restore the note from")
+		}
+	} else if r.Cmd == SYNC {
+		r.SyncArgs = &SyncArgs{}
+		fs.BoolVar(&r.SyncArgs.Merge, "merge", false, "merge the remote changes instead of rebasing onto them")
+	} else if r.Cmd == SERVE || r.Cmd == API {
+		r.ServeArgs = &ServeArgs{}
+		// Only reachable from other machines if asked for, since every note
+		// and the files in the notes directory are served, and the api can
+		// change and delete notes
+		addr := "localhost:8080"
+		if r.Cmd == API {
+			addr = "localhost:8081"
+		}
+		fs.StringVar(&r.ServeArgs.Addr, "addr", addr, "the address to serve the notes on")
 	}
 }
 
@@ -104,12 +268,28 @@ func requiresPath(command Cmd) bool {
 	case
 		NEW,
 		MV,
-		DELETE:
+		DELETE,
+		RENAME:
 		return true
 	}
 	return false
 }
 
+// parseInterspersed parses flags that may come before or after positional
+// arguments, returning the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func RequestFromArgs() Request {
 	cmds := make(map[string]Cmd)
 	cmds["new"] = NEW
@@ -122,6 +302,22 @@ func RequestFromArgs() Request {
 	cmds["git"] = GIT
 	cmds["push"] = PUSH
 	cmds["init-repo"] = INIT_REPO
+	cmds["fsck"] = FSCK
+	cmds["search"] = SEARCH
+	cmds["migrate-header"] = MIGRATE_HEADER
+	cmds["rename"] = RENAME
+	cmds["links"] = LINKS
+	cmds["trash"] = TRASH
+	cmds["today"] = TODAY
+	cmds["journal"] = JOURNAL
+	cmds["serve"] = SERVE
+	cmds["api"] = API
+	cmds["sync"] = SYNC
+	cmds["history"] = HISTORY
+	cmds["diff"] = DIFF
+	cmds["restore"] = RESTORE
+	cmds["list"] = LIST
+	cmds["tags"] = TAGS
 
 	keys := []string{}
 	for k := range cmds {
@@ -156,7 +352,43 @@ func RequestFromArgs() Request {
 			r.Args = os.Args[2:]
 		}
 		bindCommandArgs(flagSets[cmd], &r, title)
-		flagSets[cmd].Parse(os.Args[2:])
+		var positional []string
+		if requiresPath(r.Cmd) {
+			positional = parseInterspersed(flagSets[cmd], r.Args)
+		} else if r.Cmd == GIT {
+			// Flags after the git subcommand are meant for git
+			flagSets[cmd].Parse(os.Args[2:])
+			positional = flagSets[cmd].Args()
+			r.Args = positional
+		} else {
+			positional = parseInterspersed(flagSets[cmd], os.Args[2:])
+		}
+		if r.Cmd == SEARCH {
+			r.SearchArgs.Query = strings.Join(positional, " ")
+		} else if r.Cmd == RENAME && len(positional) > 0 {
+			r.RenameArgs.NewTitle = positional[0]
+		} else if r.Cmd == LINKS && len(positional) > 0 {
+			r.LinksArgs.Title = positional[0]
+		} else if r.Cmd == HISTORY || r.Cmd == DIFF || r.Cmd == RESTORE {
+			if len(positional) > 0 {
+				r.HistoryArgs.Title = positional[0]
+			}
+			if r.Cmd == DIFF && len(positional) > 1 {
+				r.HistoryArgs.Rev = positional[1]
+			}
+		} else if r.Cmd == INIT_REPO && len(positional) > 0 {
+			r.InitRepoArgs.Origin = positional[0]
+		} else if r.Cmd == TAGS && len(positional) > 0 {
+			r.TagsArgs.Action = positional[0]
+			r.TagsArgs.Names = positional[1:]
+		} else if r.Cmd == TRASH {
+			if len(positional) > 0 {
+				r.TrashArgs.Action = positional[0]
+			}
+			if len(positional) > 1 {
+				r.TrashArgs.Title = positional[1]
+			}
+		}
 	} else {
 		log.Fatalf("Unknown command '%s', must provide one of: %v\n", os.Args[1], keys)
 		os.Exit(1)
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbrunsting/note-taker/html"
+	"github.com/jbrunsting/note-taker/manager"
+)
+
+const (
+	notePrefix   = "/note/"
+	tagPrefix    = "/tag/"
+	filesPrefix  = "/files"
+	eventsPath   = "/events"
+	pollInterval = 500 * time.Millisecond
+)
+
+// reloadScript reloads the page whenever the server reports that the notes
+// have changed
+const reloadScript = `<script>
+new EventSource("` + eventsPath + `").onmessage = function() {
+    location.reload();
+};
+</script>`
+
+// Server serves the rendered notes, reloading the pages in the browser when
+// the notes directory changes
+type Server struct {
+	Manager  *manager.Manager
+	NotesDir string
+	Options  html.Options
+
+	// The manager is not safe to use from several requests at once
+	notesMu   sync.Mutex
+	clientsMu sync.Mutex
+	clients   map[chan bool]bool
+}
+
+func noteHref(title string) string {
+	return notePrefix + url.PathEscape(title)
+}
+
+// Serve listens on addr until it fails
+func (s *Server) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc(notePrefix, s.handleNote)
+	mux.HandleFunc(tagPrefix, s.handleTag)
+	mux.HandleFunc(eventsPath, s.handleEvents)
+	mux.Handle(filesPrefix+"/", http.StripPrefix(filesPrefix, s.fileServer()))
+
+	go s.watch()
+	return http.ListenAndServe(addr, mux)
+}
+
+// render writes the page for notes, with links between notes pointing at
+// their own pages when linkPages is set
+func (s *Server) render(w http.ResponseWriter, notes []manager.Note, all []manager.Note, linkPages bool) {
+	opts := s.Options
+	if linkPages {
+		opts.Href = noteHref
+		opts.LinkNotes = all
+	}
+	page, err := html.GenerateHTML(notes, filesPrefix, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page = strings.Replace(page, "</body>", reloadScript+"</body>", 1)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+func (s *Server) listNotes(w http.ResponseWriter, query manager.TagQuery) ([]manager.Note, bool) {
+	notes, err := s.Manager.ListNotes(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return notes, false
+	}
+	manager.SortNotesById(notes)
+	return notes, true
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+
+	notes, ok := s.listNotes(w, nil)
+	if ok {
+		s.render(w, notes, notes, false)
+	}
+}
+
+// handleNote serves /note/<title>, the title can also be an alias or an id
+// such as @42, as in a [[link]]
+func (s *Server) handleNote(w http.ResponseWriter, r *http.Request) {
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+
+	all, ok := s.listNotes(w, nil)
+	if !ok {
+		return
+	}
+	note, found := manager.ResolveLink(all, strings.TrimPrefix(r.URL.Path, notePrefix))
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	s.render(w, []manager.Note{note}, all, true)
+}
+
+// handleTag serves /tag/<tag>, the tag can be any tag query
+func (s *Server) handleTag(w http.ResponseWriter, r *http.Request) {
+	query, err := manager.ParseTagQuery(strings.TrimPrefix(r.URL.Path, tagPrefix))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.notesMu.Lock()
+	defer s.notesMu.Unlock()
+
+	all, ok := s.listNotes(w, nil)
+	if !ok {
+		return
+	}
+	notes, ok := s.listNotes(w, query)
+	if ok {
+		s.render(w, notes, all, true)
+	}
+}
+
+// fileServer serves the files in the notes directory that notes refer to
+// with $NOTES, hiding dot files such as the trash
+func (s *Server) fileServer() http.Handler {
+	files := http.FileServer(http.Dir(s.NotesDir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, part := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(part, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+// handleEvents streams a server sent event to the browser each time the
+// notes change
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	changed := make(chan bool, 1)
+	s.clientsMu.Lock()
+	if s.clients == nil {
+		s.clients = make(map[chan bool]bool)
+	}
+	s.clients[changed] = true
+	s.clientsMu.Unlock()
+	defer func() {
+		s.clientsMu.Lock()
+		delete(s.clients, changed)
+		s.clientsMu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case <-changed:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// snapshot describes every file in the notes directory, so that comparing
+// two snapshots tells whether anything changed. Dot directories and html
+// files are skipped, since the state directory and the regenerated
+// index.html change along with the notes.
+func (s *Server) snapshot() string {
+	var b strings.Builder
+	filepath.Walk(s.NotesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && path != s.NotesDir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || strings.HasSuffix(info.Name(), ".html") {
+			return nil
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+		return nil
+	})
+	return b.String()
+}
+
+// watch polls the notes directory, telling every connected browser to
+// reload when it changes
+func (s *Server) watch() {
+	last := s.snapshot()
+	for range time.Tick(pollInterval) {
+		current := s.snapshot()
+		if current == last {
+			continue
+		}
+		last = current
+
+		s.clientsMu.Lock()
+		for c := range s.clients {
+			select {
+			case c <- true:
+			default:
+			}
+		}
+		s.clientsMu.Unlock()
+	}
+}
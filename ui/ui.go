@@ -5,8 +5,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"sort"
-	"unicode"
+	"strings"
 
 	"github.com/jbrunsting/note-taker/manager"
 	"golang.org/x/sys/unix"
@@ -33,112 +32,65 @@ type UI struct {
 }
 
 type textSearchRow struct {
-	SecondarySort int
-	NoteTitle     string
-	LineNum       int
-	LineText      string
+	NoteTitle string
+	Line      manager.MatchLine
 }
 
-// Returns the number of characters read before a match
-func charsOccurInOrder(line string, chars string) int {
-	if len(line) == 0 || len(chars) == 0 {
-		return -1
-	}
-	i := 0
-	for li, c := range line {
-		if unicode.ToLower(rune(c)) == unicode.ToLower(rune(chars[i])) {
-			i += 1
-			if i >= len(chars) {
-				return li
-			}
-		}
-	}
-	return -1
-}
+const leadingContext = 10
 
-func getSearchTextRowComponents(text string, chars string) []RowComponent {
+func getSearchTextRowComponents(line manager.MatchLine) []RowComponent {
 	components := []RowComponent{}
-
-	curMatch := ""
-	curNonMatch := ""
-
-	i := 0
-	for ti, c := range text {
-		if unicode.ToLower(rune(c)) == unicode.ToLower(rune(chars[i])) {
-			if curNonMatch != "" {
-				components = append(components, RowComponent{curNonMatch, RowText, -1, -1})
-				curNonMatch = ""
-			}
-			curMatch += string(c)
-			i += 1
-			if i >= len(chars) {
-				if ti+1 < len(text) {
-					curNonMatch = text[ti+1:]
-				}
-				break
-			}
+	for i, part := range line.Highlight() {
+		if part == "" {
+			continue
+		}
+		if runes := []rune(part); i == 0 && len(runes) > leadingContext {
+			// Only keep a little of the text before the first match so the
+			// match is visible
+			part = "..." + string(runes[len(runes)-leadingContext:])
+		}
+		if i%2 == 0 {
+			components = append(components, RowComponent{part, RowText, -1, -1})
 		} else {
-			if curMatch != "" {
-				components = append(components, RowComponent{curMatch, RowSelectedText, -1, -1})
-				curMatch = ""
-			}
-			curNonMatch += string(c)
+			components = append(components, RowComponent{part, RowSelectedText, -1, -1})
 		}
 	}
-
-	if curMatch != "" {
-		components = append(components, RowComponent{curMatch, RowSelectedText, -1, -1})
-	}
-	if curNonMatch != "" {
-		components = append(components, RowComponent{curNonMatch, RowText, -1, -1})
-	}
-
-	// Replace the start with an elipse if it is not a match
-	if components[0].Type == RowText {
-		components[0].Text = "..."
-	}
-
 	return components
 }
 
 func (u *UI) SearchForText(notes []manager.Note) string {
+	idx, err := u.Manager.BuildFullTextIndex(notes)
+	if err != nil {
+		log.Fatalf("TODO: Error %v", err)
+	}
+
 	searchRows := []textSearchRow{}
 	getRows := func(searchKey string) [][]RowComponent {
 		searchRows = []textSearchRow{}
-		manager.SortNotes(notes, searchKey)
-		for _, note := range notes {
-			lines, err := u.Manager.ReadNote(&note)
-			if err != nil {
-				continue
-			}
+		query := manager.ParseSearchQuery(searchKey)
+		if !strings.HasSuffix(searchKey, " ") {
+			query = query.WithPrefix()
+		}
 
-			for line, text := range lines {
-				result := charsOccurInOrder(text, searchKey)
-				if result != -1 {
-					searchRows = append(
-						searchRows,
-						textSearchRow{-result, note.Title, line, text},
-					)
-				}
-				if len(searchRows) > maxSearchRows {
-					break
-				}
+		for _, result := range idx.Search(query) {
+			if len(result.Lines) == 0 {
+				// Only the title matched
+				searchRows = append(searchRows, textSearchRow{u.Manager.NoteName(result.Note), manager.MatchLine{}})
+			}
+			for _, line := range result.Lines {
+				searchRows = append(searchRows, textSearchRow{u.Manager.NoteName(result.Note), line})
 			}
 			if len(searchRows) > maxSearchRows {
 				break
 			}
 		}
 
-		sort.SliceStable(searchRows, func(i, j int) bool {
-			return searchRows[i].SecondarySort > searchRows[j].SecondarySort
-		})
-
 		rows := make([][]RowComponent, 0)
 		for _, r := range searchRows {
 			rowComponents := []RowComponent{}
 			rowComponents = append(rowComponents, RowComponent{r.NoteTitle, RowTitle, titleColumnSize, titleColumnSize})
 			rowComponents = append(rowComponents, RowComponent{"", RowDecoration, 1, 1})
-			rowComponents = append(rowComponents, getSearchTextRowComponents(r.LineText, searchKey)...)
+			rowComponents = append(rowComponents, getSearchTextRowComponents(r.Line)...)
 			rows = append(rows, rowComponents)
 		}
 
@@ -157,12 +109,12 @@ func (u *UI) SearchForText(notes []manager.Note) string {
 
 func (u *UI) SearchForNote(notes []manager.Note) string {
 	getRows := func(searchKey string) [][]RowComponent {
-		manager.SortNotes(notes, searchKey)
+		u.Manager.SortNotes(notes, searchKey)
 
 		rows := make([][]RowComponent, 0)
 		for _, note := range notes {
 			rowComponents := []RowComponent{}
-			rowComponents = append(rowComponents, RowComponent{note.Title, RowTitle, titleColumnSize, titleColumnSize})
+			rowComponents = append(rowComponents, RowComponent{u.Manager.NoteName(note), RowTitle, titleColumnSize, titleColumnSize})
 			rowComponents = append(rowComponents, RowComponent{"", RowDecoration, 1, 1})
 			rowComponents = append(rowComponents, RowComponent{note.ModTime.Format("2006/01/02 15:04:05"), RowDate, -1, -1})
 			rows = append(rows, rowComponents)
@@ -172,7 +124,7 @@ func (u *UI) SearchForNote(notes []manager.Note) string {
 	}
 
 	getResult := func(index int) string {
-		return notes[index].Title
+		return u.Manager.NoteName(notes[index])
 	}
 
 	return u.SearchList(getRows, getResult)
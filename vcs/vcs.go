@@ -0,0 +1,247 @@
+package vcs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a git command that exited with a non-zero exit code
+type Error struct {
+	Args     []string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s exited with code %d", strings.Join(e.Args, " "), e.ExitCode)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+// Repo runs git in Dir, the arguments are passed to git directly so they are
+// never interpreted by a shell
+type Repo struct {
+	Dir string
+	// Where git reads from and writes to, nil for none, as with exec.Cmd
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (r *Repo) run(stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Dir
+	cmd.Stdin = r.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if r.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(r.Stderr, &stderr)
+	}
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return &Error{args, exitErr.ExitCode(), stderr.String()}
+	}
+	return err
+}
+
+// Run runs git with args, returning an *Error if git fails
+func (r *Repo) Run(args ...string) error {
+	return r.run(r.Stdout, args...)
+}
+
+// Output runs git with args and returns what it writes to stdout
+func (r *Repo) Output(args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := r.run(&stdout, args...)
+	return stdout.String(), err
+}
+
+// IsRepo reports whether Dir is inside a git repository, it is false if git
+// is not installed
+func (r *Repo) IsRepo() bool {
+	// git explains why it is not a repository on stderr
+	quiet := *r
+	quiet.Stderr = nil
+	out, err := quiet.Output("rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// HasStagedChanges reports whether committing would create a commit
+func (r *Repo) HasStagedChanges(paths ...string) (bool, error) {
+	err := r.run(ioutil.Discard, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...)
+	if e, ok := err.(*Error); ok && e.ExitCode == 1 {
+		return true, nil
+	}
+	return false, err
+}
+
+// CommitAll stages every change and commits it with message, returning false
+// if there was nothing to commit
+func (r *Repo) CommitAll(message string) (bool, error) {
+	err := r.Run("add", "--all")
+	if err != nil {
+		return false, err
+	}
+	changed, err := r.HasStagedChanges()
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, r.Run("commit", "-m", message)
+}
+
+// CommitPaths stages the changes to paths, relative to Dir, and commits only
+// them with message, leaving any other changes as they were. Paths may have
+// been removed, and ignored paths are skipped. It returns false if there was
+// nothing to commit.
+func (r *Repo) CommitPaths(message string, paths []string) (bool, error) {
+	// git refuses to add ignored paths or paths that match no file
+	committed := []string{}
+	for _, p := range paths {
+		err := r.run(ioutil.Discard, "check-ignore", "--quiet", "--", p)
+		if err == nil {
+			continue
+		} else if e, ok := err.(*Error); !ok || e.ExitCode != 1 {
+			return false, err
+		}
+		if _, err := os.Stat(filepath.Join(r.Dir, p)); err != nil {
+			tracked, err := r.Output("ls-files", "--", p)
+			if err != nil {
+				return false, err
+			}
+			if tracked == "" {
+				continue
+			}
+		}
+		committed = append(committed, p)
+	}
+	if len(committed) == 0 {
+		return false, nil
+	}
+
+	err := r.Run(append([]string{"add", "--all", "--"}, committed...)...)
+	if err != nil {
+		return false, err
+	}
+	changed, err := r.HasStagedChanges(committed...)
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, r.Run(append([]string{"commit", "-m", message, "--"}, committed...)...)
+}
+
+// Count returns the number of commits in a range such as HEAD..@{upstream}
+func (r *Repo) Count(revRange string) (int, error) {
+	out, err := r.Output("rev-list", "--count", revRange)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(out))
+}
+
+// Conflicts returns the paths of the files in Dir with unresolved conflicts,
+// relative to Dir, which may be below the root of the repository
+func (r *Repo) Conflicts() ([]string, error) {
+	out, err := r.Output("diff", "--name-only", "--relative", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	// Paths are separated by NUL so that git does not quote them
+	paths := []string{}
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Commit is a commit that changed a file, Path is the path of the file in
+// that commit, which differs from the current path if the file was renamed
+type Commit struct {
+	Hash    string
+	Author  string
+	Date    time.Time
+	Subject string
+	Path    string
+}
+
+// History returns the commits that changed path, newest first, following
+// renames. Paths are relative to Dir.
+func (r *Repo) History(path string) ([]Commit, error) {
+	out, err := r.Output(
+		"-c", "core.quotePath=false",
+		"log", "--follow", "--relative", "--name-only",
+		"--format=%x1e%H%x1f%an%x1f%aI%x1f%s",
+		"--", path,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+	for _, record := range strings.Split(out, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, err
+		}
+		c := Commit{fields[0], fields[1], date, fields[3], path}
+		for _, line := range lines[1:] {
+			if line != "" {
+				c.Path = line
+			}
+		}
+		commits = append(commits, c)
+	}
+	return commits, nil
+}
+
+// IsAncestor reports whether the commit ancestor is rev or one of its
+// ancestors
+func (r *Repo) IsAncestor(ancestor string, rev string) (bool, error) {
+	err := r.run(ioutil.Discard, "merge-base", "--is-ancestor", ancestor, rev)
+	if e, ok := err.(*Error); ok && e.ExitCode == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PathAt returns the path the file with the given history had at rev, which
+// is its path in the newest commit of the history that rev contains
+func (r *Repo) PathAt(history []Commit, rev string) (string, error) {
+	for _, c := range history {
+		ok, err := r.IsAncestor(c.Hash, rev)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return c.Path, nil
+		}
+	}
+	return "", fmt.Errorf("The file did not exist at '%s'", rev)
+}
+
+// Init creates a repository with origin as its remote
+func (r *Repo) Init(origin string) error {
+	err := r.Run("init")
+	if err != nil {
+		return err
+	}
+	return r.Run("remote", "add", "origin", origin)
+}
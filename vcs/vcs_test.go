@@ -0,0 +1,272 @@
+package vcs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a repository in a temporary directory with a main
+// branch and an identity to commit with
+func newTestRepo(t *testing.T) *Repo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	r := &Repo{Dir: t.TempDir()}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"checkout", "-q", "-b", "main"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "commit.gpgsign", "false"},
+	} {
+		mustRun(t, r, args...)
+	}
+	return r
+}
+
+func mustRun(t *testing.T, r *Repo, args ...string) {
+	t.Helper()
+	if err := r.Run(args...); err != nil {
+		t.Fatalf("git %v: %v", args, err)
+	}
+}
+
+func writeFile(t *testing.T, r *Repo, name string, content string) {
+	t.Helper()
+	path := filepath.Join(r.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commitFile(t *testing.T, r *Repo, name string, content string, message string) {
+	t.Helper()
+	writeFile(t, r, name, content)
+	mustRun(t, r, "add", "--all")
+	mustRun(t, r, "commit", "-q", "-m", message)
+}
+
+func revParse(t *testing.T, r *Repo, rev string) string {
+	t.Helper()
+	out, err := r.Output("rev-parse", rev)
+	if err != nil {
+		t.Fatalf("rev-parse %s: %v", rev, err)
+	}
+	return strings.TrimSpace(out)
+}
+
+func TestRunReturnsExitCode(t *testing.T) {
+	r := newTestRepo(t)
+
+	err := r.Run("rev-parse", "--verify", "--quiet", "missing")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Run returned %v, want an *Error", err)
+	}
+	if e.ExitCode != 1 || !reflect.DeepEqual(e.Args, []string{"rev-parse", "--verify", "--quiet", "missing"}) {
+		t.Errorf("Run returned %+v", e)
+	}
+
+	err = r.Run("checkout", "missing")
+	if !errors.As(err, &e) || e.ExitCode == 0 || !strings.Contains(e.Stderr, "missing") {
+		t.Errorf("Run returned %v, want the stderr of git", err)
+	}
+	if !strings.Contains(err.Error(), "git checkout missing exited with code") {
+		t.Errorf("Error() is %q", err.Error())
+	}
+}
+
+func TestIsRepo(t *testing.T) {
+	r := newTestRepo(t)
+	if !r.IsRepo() {
+		t.Errorf("IsRepo is false in a repository")
+	}
+	if (&Repo{Dir: t.TempDir()}).IsRepo() {
+		t.Errorf("IsRepo is true outside of a repository")
+	}
+}
+
+func TestCommitAll(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "a.md", "a\n", "first")
+
+	committed, err := r.CommitAll("nothing")
+	if err != nil || committed {
+		t.Errorf("CommitAll with nothing to commit returned %v, %v", committed, err)
+	}
+
+	writeFile(t, r, "b.md", "b\n")
+	committed, err = r.CommitAll("second")
+	if err != nil || !committed {
+		t.Fatalf("CommitAll returned %v, %v", committed, err)
+	}
+	count, err := r.Count("HEAD")
+	if err != nil || count != 2 {
+		t.Errorf("Count is %d, %v, want 2", count, err)
+	}
+	subject, _ := r.Output("log", "-1", "--format=%s")
+	if strings.TrimSpace(subject) != "second" {
+		t.Errorf("The last commit is %q", subject)
+	}
+}
+
+func TestCommitPaths(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, ".gitignore", "ignored.html\n", "ignore")
+	commitFile(t, r, "removed.md", "removed\n", "removed")
+	writeFile(t, r, "unrelated.md", "unrelated\n")
+	writeFile(t, r, "notes/a.md", "a\n")
+	writeFile(t, r, "ignored.html", "html\n")
+	if err := os.Remove(filepath.Join(r.Dir, "removed.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	committed, err := r.CommitPaths("paths", []string{"notes/a.md", "removed.md", "ignored.html", "never-existed.md"})
+	if err != nil || !committed {
+		t.Fatalf("CommitPaths returned %v, %v", committed, err)
+	}
+	files, _ := r.Output("show", "--name-status", "--format=", "HEAD")
+	if files != "A\tnotes/a.md\nD\tremoved.md\n" {
+		t.Errorf("The commit changed %q", files)
+	}
+	status, _ := r.Output("status", "--porcelain")
+	if status != "?? unrelated.md\n" {
+		t.Errorf("The status after committing is %q", status)
+	}
+
+	committed, err = r.CommitPaths("nothing", []string{"notes/a.md", "never-existed.md"})
+	if err != nil || committed {
+		t.Errorf("CommitPaths with nothing to commit returned %v, %v", committed, err)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "my note.md", "base\n", "base")
+	commitFile(t, r, "other.md", "base\n", "other")
+	mustRun(t, r, "checkout", "-q", "-b", "theirs")
+	commitFile(t, r, "my note.md", "theirs\n", "theirs")
+	commitFile(t, r, "other.md", "theirs\n", "theirs other")
+	mustRun(t, r, "checkout", "-q", "main")
+	commitFile(t, r, "my note.md", "ours\n", "ours")
+
+	conflicts, err := r.Conflicts()
+	if err != nil || len(conflicts) != 0 {
+		t.Errorf("Conflicts before merging returned %v, %v", conflicts, err)
+	}
+
+	if err := r.Run("merge", "-q", "theirs"); err == nil {
+		t.Fatalf("The merge should have conflicted")
+	}
+	conflicts, err = r.Conflicts()
+	if err != nil {
+		t.Fatalf("Conflicts: %v", err)
+	}
+	// Names with spaces are not quoted or split
+	if !reflect.DeepEqual(conflicts, []string{"my note.md"}) {
+		t.Errorf("Conflicts returned %q", conflicts)
+	}
+}
+
+func TestConflictsAreRelativeToDir(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "notes/a.md", "base\n", "base")
+	mustRun(t, r, "checkout", "-q", "-b", "theirs")
+	commitFile(t, r, "notes/a.md", "theirs\n", "theirs")
+	mustRun(t, r, "checkout", "-q", "main")
+	commitFile(t, r, "notes/a.md", "ours\n", "ours")
+	if err := r.Run("merge", "-q", "theirs"); err == nil {
+		t.Fatalf("The merge should have conflicted")
+	}
+
+	sub := &Repo{Dir: filepath.Join(r.Dir, "notes")}
+	conflicts, err := sub.Conflicts()
+	if err != nil || !reflect.DeepEqual(conflicts, []string{"a.md"}) {
+		t.Errorf("Conflicts returned %q, %v", conflicts, err)
+	}
+}
+
+func TestHistoryFollowsRenames(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "a.md", "line one\nline two\nline three\n", "create")
+	first := revParse(t, r, "HEAD")
+	mustRun(t, r, "mv", "a.md", "b.md")
+	mustRun(t, r, "commit", "-q", "-m", "rename")
+	commitFile(t, r, "unrelated.md", "x\n", "unrelated")
+	commitFile(t, r, "b.md", "line one\nline two\nline three\nline four\n", "edit")
+
+	history, err := r.History("b.md")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	subjects := []string{}
+	paths := []string{}
+	for _, c := range history {
+		subjects = append(subjects, c.Subject)
+		paths = append(paths, c.Path)
+		if c.Author != "Test" || c.Date.IsZero() {
+			t.Errorf("Commit %+v is missing its author or date", c)
+		}
+	}
+	if !reflect.DeepEqual(subjects, []string{"edit", "rename", "create"}) {
+		t.Errorf("History has the commits %v", subjects)
+	}
+	if !reflect.DeepEqual(paths, []string{"b.md", "b.md", "a.md"}) {
+		t.Errorf("History has the paths %v", paths)
+	}
+	if history[2].Hash != first {
+		t.Errorf("The oldest commit is %s, want %s", history[2].Hash, first)
+	}
+}
+
+func TestHistoryIsRelativeToDir(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "notes/a.md", "a\n", "create")
+	sub := &Repo{Dir: filepath.Join(r.Dir, "notes")}
+
+	history, err := sub.History("a.md")
+	if err != nil || len(history) != 1 || history[0].Path != "a.md" {
+		t.Errorf("History returned %+v, %v", history, err)
+	}
+}
+
+func TestPathAt(t *testing.T) {
+	r := newTestRepo(t)
+	commitFile(t, r, "other.md", "x\n", "before")
+	before := revParse(t, r, "HEAD")
+	commitFile(t, r, "a.md", "line one\nline two\nline three\n", "create")
+	created := revParse(t, r, "HEAD")
+	mustRun(t, r, "mv", "a.md", "b.md")
+	mustRun(t, r, "commit", "-q", "-m", "rename")
+
+	history, err := r.History("b.md")
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	for _, test := range []struct {
+		rev  string
+		path string
+	}{
+		{created, "a.md"},
+		{"HEAD~1", "a.md"},
+		{"HEAD", "b.md"},
+	} {
+		path, err := r.PathAt(history, test.rev)
+		if err != nil || path != test.path {
+			t.Errorf("PathAt(%s) returned %q, %v, want %q", test.rev, path, err, test.path)
+		}
+	}
+
+	if _, err := r.PathAt(history, before); err == nil {
+		t.Errorf("PathAt before the file existed should fail")
+	}
+}